@@ -0,0 +1,156 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/kitex-contrib/registry-servicecomb/servicecomb"
+)
+
+// endpoints returns the endpoints registered for addr. The advertise address
+// takes precedence, and an unspecified host is replaced by the detected local
+// address(es).
+func (scr *serviceCombRegistry) endpoints(addr net.Addr) ([]string, error) {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil, err
+	}
+	if scr.opts.advertisePort > 0 {
+		port = strconv.Itoa(scr.opts.advertisePort)
+	}
+	if scr.opts.advertiseHost != "" {
+		host = scr.opts.advertiseHost
+	}
+	if host != "" && !net.ParseIP(host).IsUnspecified() {
+		return scr.withScheme([]string{net.JoinHostPort(host, port)}), nil
+	}
+
+	ipv4, ipv6, err := scr.getLocalHosts()
+	if err != nil {
+		return nil, err
+	}
+	var endpoints []string
+	switch {
+	case scr.opts.dualStack:
+		if ipv4 != "" {
+			endpoints = append(endpoints, net.JoinHostPort(ipv4, port))
+		}
+		if ipv6 != "" {
+			endpoints = append(endpoints, net.JoinHostPort(ipv6, port))
+		}
+	case scr.opts.ipv6:
+		if ipv6 == "" {
+			return nil, errors.New("not found ipv6 address")
+		}
+		endpoints = append(endpoints, net.JoinHostPort(ipv6, port))
+	default:
+		if ipv4 == "" {
+			return nil, errors.New("not found ipv4 address")
+		}
+		endpoints = append(endpoints, net.JoinHostPort(ipv4, port))
+	}
+	if len(endpoints) == 0 {
+		return nil, errors.New("not found ip address")
+	}
+	return scr.withScheme(endpoints), nil
+}
+
+// withScheme prefixes the endpoints with the configured scheme.
+func (scr *serviceCombRegistry) withScheme(endpoints []string) []string {
+	for i, endpoint := range endpoints {
+		endpoints[i] = servicecomb.FormatEndpoint(scr.opts.scheme, endpoint, scr.opts.schemeParams)
+	}
+	return endpoints
+}
+
+// getLocalHosts returns the first non-loopback IPv4 address and the first
+// global unicast IPv6 address accepted by the interface and CIDR options,
+// either may be empty.
+func (scr *serviceCombRegistry) getLocalHosts() (ipv4, ipv6 string, err error) {
+	allowed, err := parseCIDRs(scr.opts.allowedCIDRs)
+	if err != nil {
+		return "", "", err
+	}
+	denied, err := parseCIDRs(scr.opts.deniedCIDRs)
+	if err != nil {
+		return "", "", err
+	}
+
+	var addrs []net.Addr
+	if scr.opts.interfaceName != "" {
+		iface, err := net.InterfaceByName(scr.opts.interfaceName)
+		if err != nil {
+			return "", "", err
+		}
+		addrs, err = iface.Addrs()
+		if err != nil {
+			return "", "", err
+		}
+	} else {
+		addrs, err = net.InterfaceAddrs()
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	for _, addr := range addrs {
+		ipNet, isIpNet := addr.(*net.IPNet)
+		if !isIpNet || ipNet.IP.IsLoopback() || !acceptIP(ipNet.IP, allowed, denied) {
+			continue
+		}
+		if ip := ipNet.IP.To4(); ip != nil {
+			if ipv4 == "" {
+				ipv4 = ip.String()
+			}
+		} else if ipv6 == "" && ipNet.IP.IsGlobalUnicast() {
+			ipv6 = ipNet.IP.String()
+		}
+	}
+	return ipv4, ipv6, nil
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parse cidr %s error: %w", cidr, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// acceptIP reports whether ip is within allowed (if any) and not within denied.
+func acceptIP(ip net.IP, allowed, denied []*net.IPNet) bool {
+	for _, ipNet := range denied {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, ipNet := range allowed {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// test endpoints are formatted for both address families
+func TestSCRegistryEndpoints(t *testing.T) {
+	scr := NewSCRegistry(nil).(*serviceCombRegistry)
+	got, err := scr.endpoints(&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 8080})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"[2001:db8::1]:8080"}, got)
+	got, err = scr.endpoints(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"127.0.0.1:8080"}, got)
+}
+
+// test the advertise address overrides the listening one
+func TestSCRegistryAdvertiseAddr(t *testing.T) {
+	scr := NewSCRegistry(nil, WithAdvertiseAddr("10.0.0.1", 30080)).(*serviceCombRegistry)
+	got, err := scr.endpoints(&net.TCPAddr{Port: 8080})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.1:30080"}, got)
+
+	scr = NewSCRegistry(nil, WithAdvertiseAddr("", 30080)).(*serviceCombRegistry)
+	got, err = scr.endpoints(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"127.0.0.1:30080"}, got)
+}
+
+// test filtering local addresses by cidr
+func TestAcceptIP(t *testing.T) {
+	allowed, err := parseCIDRs([]string{"10.0.0.0/8"})
+	assert.Nil(t, err)
+	denied, err := parseCIDRs([]string{"10.1.0.0/16", "172.17.0.0/16"})
+	assert.Nil(t, err)
+	assert.True(t, acceptIP(net.ParseIP("10.2.0.1"), allowed, denied))
+	assert.False(t, acceptIP(net.ParseIP("10.1.0.1"), allowed, denied))
+	assert.False(t, acceptIP(net.ParseIP("192.168.0.1"), allowed, denied))
+	assert.False(t, acceptIP(net.ParseIP("172.17.0.1"), nil, denied))
+	assert.True(t, acceptIP(net.ParseIP("192.168.0.1"), nil, denied))
+
+	_, err = parseCIDRs([]string{"10.0.0.0"})
+	assert.NotNil(t, err)
+}
+
+// test endpoints are prefixed with the configured scheme
+func TestSCRegistryEndpointScheme(t *testing.T) {
+	scr := NewSCRegistry(nil, WithEndpointScheme("kitex", map[string]string{"protocol": "ttheader"})).(*serviceCombRegistry)
+	got, err := scr.endpoints(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"kitex://127.0.0.1:8080?protocol=ttheader"}, got)
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+// EventType is the type of an instance lifecycle event.
+type EventType string
+
+// Instance lifecycle events.
+const (
+	EventRegistered         EventType = "registered"
+	EventRegisterFailed     EventType = "register_failed"
+	EventHeartbeatFailed    EventType = "heartbeat_failed"
+	EventHeartbeatRecovered EventType = "heartbeat_recovered"
+	EventReRegistered       EventType = "re_registered"
+	EventDeregistered       EventType = "deregistered"
+)
+
+// Event describes a change of an instance registered by the registry.
+type Event struct {
+	Type        EventType
+	ServiceName string
+	InstanceId  string
+	// Err is set for EventRegisterFailed and EventHeartbeatFailed.
+	Err error
+}
+
+// Listener receives instance events. It is called synchronously from the
+// registry and heartbeat goroutines, so it must not block.
+type Listener func(event Event)
+
+// WithListener with a listener of instance events, can be used several times
+func WithListener(listener Listener) Option {
+	return func(o *options) {
+		o.listeners = append(o.listeners, listener)
+	}
+}
+
+// emit sends the event of hb to all listeners.
+func (scr *serviceCombRegistry) emit(eventType EventType, hb *scHeartbeat, err error) {
+	if len(scr.opts.listeners) == 0 {
+		return
+	}
+	scr.lock.RLock()
+	event := Event{
+		Type:        eventType,
+		ServiceName: hb.service.ServiceName,
+		InstanceId:  hb.instanceId,
+		Err:         err,
+	}
+	scr.lock.RUnlock()
+	for _, listener := range scr.opts.listeners {
+		listener(event)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chassis/cari/discovery"
+	"github.com/go-chassis/sc-client"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRequest struct {
+	method     string
+	path       string
+	query      string
+	consumerId string
+	body       string
+}
+
+// fakeSC is a minimal in-memory ServiceComb server recording the requests it
+// receives. A request is handled by hook first if it returns true.
+type fakeSC struct {
+	server    *httptest.Server
+	lock      sync.Mutex
+	requests  []fakeRequest
+	instances map[string]*discovery.MicroServiceInstance
+	nextId    int
+	hook      func(w http.ResponseWriter, r *http.Request, body []byte) bool
+}
+
+func newFakeSC(t *testing.T) (*fakeSC, *sc.Client) {
+	f := &fakeSC{instances: make(map[string]*discovery.MicroServiceInstance)}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	cli, err := sc.NewClient(sc.Options{Endpoints: []string{strings.TrimPrefix(f.server.URL, "http://")}})
+	assert.Nil(t, err)
+	return f, cli
+}
+
+func (f *fakeSC) setHook(hook func(w http.ResponseWriter, r *http.Request, body []byte) bool) {
+	f.lock.Lock()
+	f.hook = hook
+	f.lock.Unlock()
+}
+
+// requestsOf returns the recorded requests of method whose path ends with suffix.
+func (f *fakeSC) requestsOf(method, suffix string) []fakeRequest {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var res []fakeRequest
+	for _, r := range f.requests {
+		if r.method == method && strings.HasSuffix(r.path, suffix) {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// calls returns the recorded requests as "METHOD path" in order.
+func (f *fakeSC) calls() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	res := make([]string, 0, len(f.requests))
+	for _, r := range f.requests {
+		res = append(res, r.method+" "+r.path)
+	}
+	return res
+}
+
+func (f *fakeSC) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	path := strings.TrimPrefix(r.URL.Path, sc.MSAPIPath)
+	f.lock.Lock()
+	f.requests = append(f.requests, fakeRequest{
+		method:     r.Method,
+		path:       path,
+		query:      r.URL.RawQuery,
+		consumerId: r.Header.Get("X-ConsumerId"),
+		body:       string(body),
+	})
+	hook := f.hook
+	f.lock.Unlock()
+	if hook != nil && hook(w, r, body) {
+		return
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case r.Method == http.MethodPost && path == "/microservices":
+		writeJSON(w, &discovery.GetExistenceResponse{ServiceId: "s1"})
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[2] == "instances":
+		var req discovery.RegisterInstanceRequest
+		_ = json.Unmarshal(body, &req)
+		f.lock.Lock()
+		if req.Instance.InstanceId == "" {
+			f.nextId++
+			req.Instance.InstanceId = fmt.Sprintf("i%d", f.nextId)
+		}
+		f.instances[req.Instance.InstanceId] = req.Instance
+		f.lock.Unlock()
+		writeJSON(w, &discovery.RegisterInstanceResponse{InstanceId: req.Instance.InstanceId})
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[2] == "instances":
+		f.lock.Lock()
+		res := &discovery.GetInstancesResponse{}
+		for _, in := range f.instances {
+			res.Instances = append(res.Instances, in)
+		}
+		f.lock.Unlock()
+		writeJSON(w, res)
+	case r.Method == http.MethodDelete && len(parts) == 4 && parts[2] == "instances":
+		f.lock.Lock()
+		delete(f.instances, parts[3])
+		f.lock.Unlock()
+		writeJSON(w, struct{}{})
+	default:
+		writeJSON(w, struct{}{})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,174 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/go-chassis/cari/discovery"
+	"github.com/go-chassis/sc-client"
+)
+
+const minBackoff = time.Second
+
+// heartBeat handles the heartbeat result err of hb after failures consecutive
+// failed beats, and returns the updated failures and the delay before the
+// next beat. Failed beats are retried with exponential backoff, and the
+// instance is registered again once ServiceComb reports that it no longer
+// exists.
+func (scr *serviceCombRegistry) heartBeat(ctx context.Context, hb *scHeartbeat, failures int, err error) (int, time.Duration) {
+	if err != nil && isNotExistsError(err) {
+		klog.CtxWarnf(ctx, "instance %s is lost in ServiceComb, register it again", hb.instanceKey)
+		err = scr.reRegister(ctx, hb)
+	}
+	if err != nil {
+		failures++
+		delay := scr.backoff(failures)
+		klog.CtxErrorf(ctx, "beat to ServiceComb return error:%+v instance:%s, retry in %v", err, hb.instanceKey, delay)
+		scr.emit(EventHeartbeatFailed, hb, err)
+		return failures, delay
+	}
+	if failures > 0 {
+		klog.CtxInfof(ctx, "beat to ServiceComb recovered after %d failures, instance:%s", failures, hb.instanceKey)
+		scr.emit(EventHeartbeatRecovered, hb, nil)
+	}
+	return 0, scr.heartbeatDelay()
+}
+
+// heartbeatDelay returns the heartbeat interval with up to 10% jitter, so that
+// the beats of many instances do not stay aligned.
+func (scr *serviceCombRegistry) heartbeatDelay() time.Duration {
+	interval := time.Second * time.Duration(scr.opts.heartbeatInterval)
+	if interval <= 0 {
+		interval = time.Second * time.Duration(sc.DefaultLeaseRenewalInterval)
+	}
+	jitter := int64(interval / 10)
+	return interval - time.Duration(jitter) + time.Duration(rand.Int63n(2*jitter+1))
+}
+
+// beatAll sends the heartbeats of heartbeats with a single batch request, and
+// returns the result of each of them. When the batch request can not reach
+// ServiceComb or is not supported by it, the heartbeats are sent one by one
+// with sc.Client instead.
+func (scr *serviceCombRegistry) beatAll(heartbeats []*scHeartbeat) map[*scHeartbeat]error {
+	request := &discovery.HeartbeatSetRequest{Instances: make([]*discovery.HeartbeatSetElement, 0, len(heartbeats))}
+	scr.lock.RLock()
+	for _, hb := range heartbeats {
+		request.Instances = append(request.Instances, &discovery.HeartbeatSetElement{
+			ServiceId:  hb.serviceId,
+			InstanceId: hb.instanceId,
+		})
+	}
+	scr.lock.RUnlock()
+
+	var response discovery.HeartbeatSetResponse
+	err := scr.rest.do(http.MethodPut, "/heartbeats", request, &response)
+	results := make(map[*scHeartbeat]error, len(heartbeats))
+	var se *statusError
+	if err != nil && (!errors.As(err, &se) || se.code == http.StatusNotFound || se.code == http.StatusMethodNotAllowed) {
+		klog.Warnf("batch heartbeat error:%v, send the heartbeats one by one", err)
+		for i, hb := range heartbeats {
+			results[hb] = scr.beat(request.Instances[i].ServiceId, request.Instances[i].InstanceId)
+		}
+		return results
+	}
+	failed := make(map[string]string, len(response.Instances))
+	for _, rst := range response.Instances {
+		if rst.ErrMessage != "" {
+			failed[rst.InstanceId] = rst.ErrMessage
+		}
+	}
+	for i, hb := range heartbeats {
+		switch msg, ok := failed[request.Instances[i].InstanceId]; {
+		case ok:
+			results[hb] = fmt.Errorf("heartbeat error: %s", msg)
+		case err != nil && len(response.Instances) == 0:
+			// the whole request failed
+			results[hb] = err
+		default:
+			results[hb] = nil
+		}
+	}
+	return results
+}
+
+// beat sends the heartbeat of a single instance with sc.Client.
+func (scr *serviceCombRegistry) beat(serviceId, instanceId string) error {
+	success, err := scr.cli.Heartbeat(serviceId, instanceId)
+	if err != nil {
+		return err
+	}
+	if !success {
+		return errors.New("heartbeat is not accepted")
+	}
+	return nil
+}
+
+// reRegister registers hb again. An instance registered after the heartbeat
+// has been cancelled is removed right away so that it is not leaked.
+func (scr *serviceCombRegistry) reRegister(ctx context.Context, hb *scHeartbeat) error {
+	if err := scr.registerInstance(hb); err != nil {
+		return err
+	}
+	scr.lock.RLock()
+	serviceId, instanceId := hb.serviceId, hb.instanceId
+	scr.lock.RUnlock()
+	if ctx.Err() != nil {
+		_, err := scr.cli.UnregisterMicroServiceInstance(serviceId, instanceId)
+		return err
+	}
+	klog.CtxInfof(ctx, "instance %s registered again, instance id:%s", hb.instanceKey, instanceId)
+	scr.emit(EventReRegistered, hb, nil)
+	return nil
+}
+
+// backoff returns the delay before the next heartbeat retry.
+func (scr *serviceCombRegistry) backoff(failures int) time.Duration {
+	return expBackoff(failures, minBackoff, scr.opts.maxBackoff)
+}
+
+// expBackoff returns the delay before the next retry, doubling from initial
+// per failure up to max with up to half of it randomized.
+func expBackoff(failures int, initial, max time.Duration) time.Duration {
+	if initial <= 0 {
+		initial = minBackoff
+	}
+	delay := max
+	if failures < 32 && initial<<uint(failures-1) < delay {
+		delay = initial << uint(failures-1)
+	}
+	if delay <= 0 {
+		delay = initial
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// isNotExistsError reports whether err means the service or the instance is
+// unknown to ServiceComb.
+func isNotExistsError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, strconv.Itoa(int(discovery.ErrInstanceNotExists))) ||
+		strings.Contains(msg, strconv.Itoa(int(discovery.ErrServiceNotExists))) ||
+		strings.Contains(strings.ToLower(msg), "does not exist")
+}
@@ -0,0 +1,170 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/go-chassis/cari/discovery"
+	"github.com/go-chassis/sc-client"
+	"github.com/stretchr/testify/assert"
+)
+
+// test the heartbeat retry delay grows and stays bounded
+func TestSCRegistryBackoff(t *testing.T) {
+	scr := NewSCRegistry(nil, WithHeartbeatMaxBackoff(8*time.Second)).(*serviceCombRegistry)
+	for failures, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second} {
+		got := scr.backoff(failures + 1)
+		assert.True(t, got >= want/2 && got <= want, "failures:%d delay:%v", failures+1, got)
+	}
+	assert.True(t, scr.backoff(100) <= 8*time.Second)
+}
+
+// test detecting the instance not found response
+func TestIsNotExistsError(t *testing.T) {
+	assert.True(t, isNotExistsError(sc.NewCommonException("result: %d %s", 400,
+		`{"errorCode":"400017","errorMessage":"Instance does not exist"}`)))
+	assert.True(t, isNotExistsError(sc.NewCommonException("result: %d %s", 400,
+		`{"errorCode":"400012","errorMessage":"Micro-service does not exist"}`)))
+	assert.False(t, isNotExistsError(errors.New("connection refused")))
+}
+
+// test the heartbeats of a round are sent in one batch request
+func TestSCRegistryBeatAll(t *testing.T) {
+	fake, client := newFakeSC(t)
+	scr := NewSCRegistry(client).(*serviceCombRegistry)
+	hb1 := &scHeartbeat{serviceId: "s1", instanceId: "i1"}
+	hb2 := &scHeartbeat{serviceId: "s1", instanceId: "i2"}
+
+	results := scr.beatAll([]*scHeartbeat{hb1, hb2})
+	assert.Nil(t, results[hb1])
+	assert.Nil(t, results[hb2])
+	requests := fake.requestsOf("PUT", "/heartbeats")
+	assert.Len(t, requests, 1)
+	var body discovery.HeartbeatSetRequest
+	assert.Nil(t, json.Unmarshal([]byte(requests[0].body), &body))
+	assert.Equal(t, []*discovery.HeartbeatSetElement{
+		{ServiceId: "s1", InstanceId: "i1"},
+		{ServiceId: "s1", InstanceId: "i2"},
+	}, body.Instances)
+
+	fake.setHook(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, &discovery.HeartbeatSetResponse{Instances: []*discovery.InstanceHbRst{
+			{ServiceId: "s1", InstanceId: "i1"},
+			{ServiceId: "s1", InstanceId: "i2", ErrMessage: "Service instance does not exist."},
+		}})
+		return true
+	})
+	results = scr.beatAll([]*scHeartbeat{hb1, hb2})
+	assert.Nil(t, results[hb1])
+	assert.NotNil(t, results[hb2])
+	assert.True(t, isNotExistsError(results[hb2]))
+
+	fake.setHook(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		w.WriteHeader(http.StatusInternalServerError)
+		return true
+	})
+	results = scr.beatAll([]*scHeartbeat{hb1, hb2})
+	assert.NotNil(t, results[hb1])
+	assert.NotNil(t, results[hb2])
+	assert.False(t, isNotExistsError(results[hb1]))
+}
+
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("tls: handshake failure")
+}
+
+// test the heartbeats are sent one by one when the batch request can not be sent
+func TestSCRegistryBeatAllFallback(t *testing.T) {
+	fake, client := newFakeSC(t)
+	scr := NewSCRegistry(client).(*serviceCombRegistry)
+	scr.rest.httpClient.Transport = failingTransport{}
+	hb1 := &scHeartbeat{serviceId: "s1", instanceId: "i1"}
+	hb2 := &scHeartbeat{serviceId: "s1", instanceId: "i2"}
+	results := scr.beatAll([]*scHeartbeat{hb1, hb2})
+	assert.Nil(t, results[hb1])
+	assert.Nil(t, results[hb2])
+	assert.Len(t, fake.requestsOf("PUT", "/instances/i1/heartbeat"), 1)
+	assert.Len(t, fake.requestsOf("PUT", "/instances/i2/heartbeat"), 1)
+
+	// Service Center without the batch API
+	scr = NewSCRegistry(client).(*serviceCombRegistry)
+	fake.setHook(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		if strings.HasSuffix(r.URL.Path, "/heartbeats") {
+			w.WriteHeader(http.StatusNotFound)
+			return true
+		}
+		return false
+	})
+	results = scr.beatAll([]*scHeartbeat{hb1})
+	assert.Nil(t, results[hb1])
+	assert.Len(t, fake.requestsOf("PUT", "/instances/i1/heartbeat"), 2)
+}
+
+// test an instance reported missing by the heartbeat is registered again
+func TestSCRegistryReRegister(t *testing.T) {
+	fake, client := newFakeSC(t)
+	events := make(chan Event, 10)
+	scr := NewSCRegistry(client, WithListener(func(event Event) { events <- event })).(*serviceCombRegistry)
+	defer scr.scheduler.stop()
+	info := &registry.Info{
+		ServiceName: ServiceName,
+		Addr:        &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8095},
+	}
+	assert.Nil(t, scr.Register(info))
+	hb := scr.registryIns[ServiceName+":"+info.Addr.String()]
+	assert.Equal(t, "s1", hb.serviceId)
+	assert.Equal(t, "i1", hb.instanceId)
+	assert.Equal(t, EventRegistered, (<-events).Type)
+
+	fake.setHook(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		switch {
+		case r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/heartbeats"):
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, &discovery.HeartbeatSetResponse{Instances: []*discovery.InstanceHbRst{
+				{ServiceId: "s1", InstanceId: "i1", ErrMessage: "Service instance does not exist."},
+			}})
+			return true
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/microservices"):
+			writeJSON(w, &discovery.GetExistenceResponse{ServiceId: "s2"})
+			return true
+		}
+		return false
+	})
+	results := scr.beatAll([]*scHeartbeat{hb})
+	failures, delay := scr.heartBeat(context.Background(), hb, 0, results[hb])
+	assert.True(t, delay >= 4*time.Second, "delay:%v", delay)
+
+	assert.Len(t, fake.requestsOf("POST", "/microservices"), 2)
+	assert.Len(t, fake.requestsOf("POST", "/microservices/s1/instances"), 1)
+	assert.Len(t, fake.requestsOf("POST", "/microservices/s2/instances"), 1)
+	assert.Equal(t, "s2", hb.serviceId)
+	assert.Equal(t, "i2", hb.instanceId)
+	assert.Equal(t, 0, failures)
+	event := <-events
+	assert.Equal(t, EventReRegistered, event.Type)
+	assert.Equal(t, "i2", event.InstanceId)
+}
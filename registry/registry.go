@@ -16,9 +16,12 @@ package registry
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"net"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -33,6 +36,11 @@ import (
 type scHeartbeat struct {
 	cancel      context.CancelFunc
 	instanceKey string
+	service     *discovery.MicroService
+	instance    *discovery.MicroServiceInstance
+	schemas     []schema
+	serviceId   string
+	instanceId  string
 }
 
 type options struct {
@@ -40,6 +48,35 @@ type options struct {
 	versionRule       string
 	hostName          string
 	heartbeatInterval int32
+	tagPrefix         string
+	maxBackoff        time.Duration
+	drainStatus       string
+	drainPeriod       time.Duration
+	schemas           map[string][]schema
+	environment       string
+	description       string
+	level             string
+	alias             string
+	serviceProperties map[string]string
+	ipv6              bool
+	dualStack         bool
+	interfaceName     string
+	allowedCIDRs      []string
+	deniedCIDRs       []string
+	advertiseHost     string
+	advertisePort     int
+	scheme            string
+	schemeParams      url.Values
+	listeners         []Listener
+	registerAttempts  int
+	registerTimeout   time.Duration
+	registerBackoff   time.Duration
+	registerMaxDelay  time.Duration
+	asyncRegister     bool
+	instanceId        string
+	existingPolicy    ExistingInstancePolicy
+	dataCenter        *discovery.DataCenterInfo
+	tlsConfig         *tls.Config
 }
 
 // Option is ServiceComb option.
@@ -72,15 +109,227 @@ func WithHeartbeatInterval(second int32) Option {
 	}
 }
 
+// WithHeartbeatMaxBackoff with the upper bound of the delay between heartbeat retries
+func WithHeartbeatMaxBackoff(maxBackoff time.Duration) Option {
+	return func(o *options) {
+		o.maxBackoff = maxBackoff
+	}
+}
+
+// WithDrain with graceful drain option, instances are switched to status
+// (servicecomb.StatusDown or servicecomb.StatusOutOfService) and kept for period
+// before they are deregistered. Other statuses fall back to servicecomb.StatusDown.
+func WithDrain(status string, period time.Duration) Option {
+	return func(o *options) {
+		o.drainStatus = status
+		o.drainPeriod = period
+	}
+}
+
+// WithEnvironment with service environment option, one of development,
+// testing, acceptance and production. ServiceComb only lets services of the
+// same environment discover each other.
+func WithEnvironment(environment string) Option {
+	return func(o *options) {
+		o.environment = environment
+	}
+}
+
+// WithDescription with service description option
+func WithDescription(description string) Option {
+	return func(o *options) {
+		o.description = description
+	}
+}
+
+// WithLevel with service level option, e.g. FRONT, MIDDLE or BACK
+func WithLevel(level string) Option {
+	return func(o *options) {
+		o.level = level
+	}
+}
+
+// WithAlias with service alias option
+func WithAlias(alias string) Option {
+	return func(o *options) {
+		o.alias = alias
+	}
+}
+
+// WithServiceProperties with the properties of the service, not of its instances
+func WithServiceProperties(properties map[string]string) Option {
+	return func(o *options) {
+		o.serviceProperties = properties
+	}
+}
+
+// WithIPv6 detects an IPv6 address instead of an IPv4 one when the server
+// listens on an unspecified address
+func WithIPv6() Option {
+	return func(o *options) {
+		o.ipv6 = true
+	}
+}
+
+// WithDualStack registers both the detected IPv4 and IPv6 endpoints on one
+// instance when the server listens on an unspecified address
+func WithDualStack() Option {
+	return func(o *options) {
+		o.dualStack = true
+	}
+}
+
+// WithInterfaceName detects the local address on the named network interface only
+func WithInterfaceName(name string) Option {
+	return func(o *options) {
+		o.interfaceName = name
+	}
+}
+
+// WithAllowedCIDRs detects the local address within one of cidrs only
+func WithAllowedCIDRs(cidrs ...string) Option {
+	return func(o *options) {
+		o.allowedCIDRs = append(o.allowedCIDRs, cidrs...)
+	}
+}
+
+// WithDeniedCIDRs never detects a local address within one of cidrs
+func WithDeniedCIDRs(cidrs ...string) Option {
+	return func(o *options) {
+		o.deniedCIDRs = append(o.deniedCIDRs, cidrs...)
+	}
+}
+
+// WithAdvertiseAddr registers host and port instead of the listening ones,
+// for NAT and container port mapping. Empty host or zero port keeps the
+// listening value.
+func WithAdvertiseAddr(host string, port int) Option {
+	return func(o *options) {
+		o.advertiseHost = host
+		o.advertisePort = port
+	}
+}
+
+// WithEndpointScheme registers scheme-prefixed endpoints like Java ServiceComb,
+// e.g. kitex://host:port?protocol=ttheader, instead of bare host:port ones
+func WithEndpointScheme(scheme string, params map[string]string) Option {
+	return func(o *options) {
+		o.scheme = scheme
+		o.schemeParams = url.Values{}
+		for k, v := range params {
+			o.schemeParams.Set(k, v)
+		}
+	}
+}
+
+// WithRegisterRetry retries a failed registration with the backoff of
+// WithRegisterBackoff, up to maxAttempts times and within timeout. Zero means
+// no limit.
+func WithRegisterRetry(maxAttempts int, timeout time.Duration) Option {
+	return func(o *options) {
+		o.registerAttempts = maxAttempts
+		o.registerTimeout = timeout
+	}
+}
+
+// WithRegisterBackoff with the delay before the first registration retry,
+// doubled per failure up to maxDelay, 1s and 30s by default
+func WithRegisterBackoff(initial, maxDelay time.Duration) Option {
+	return func(o *options) {
+		o.registerBackoff = initial
+		o.registerMaxDelay = maxDelay
+	}
+}
+
+// WithAsyncRegister makes Register return right after validating the info and
+// keep registering in background until it succeeds or the instance is
+// deregistered. Every failed attempt emits EventRegisterFailed.
+func WithAsyncRegister() Option {
+	return func(o *options) {
+		o.asyncRegister = true
+	}
+}
+
+// WithInstanceId registers instances with a stable id such as the pod name,
+// so that a restarted process takes over its previous instance. The id is
+// shared by all registrations, so only one instance of a service can use it,
+// the instance_id tag of registry.Info sets the id of a single instance.
+func WithInstanceId(instanceId string) Option {
+	return func(o *options) {
+		o.instanceId = instanceId
+	}
+}
+
+// WithExistingInstancePolicy with the handling of an instance left by a
+// previous process with the same endpoint, ExistingInstanceIgnore by default
+func WithExistingInstancePolicy(policy ExistingInstancePolicy) Option {
+	return func(o *options) {
+		o.existingPolicy = policy
+	}
+}
+
+// WithDataCenter with the datacenter name, region and availability zone of
+// instances, which default to the environment variables of servicecomb.SCDataCenter
+func WithDataCenter(name, region, zone string) Option {
+	return func(o *options) {
+		o.dataCenter = &discovery.DataCenterInfo{Name: name, Region: region, AvailableZone: zone}
+	}
+}
+
+// WithTLSConfig with the TLS config of the ServiceComb requests sent without
+// sc.Client, i.e. schema uploads and batch heartbeats. It should match the one
+// of the client, heartbeats fall back to sc.Client when it does not work.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = tlsConfig
+	}
+}
+
+// WithTagPrefix with the prefix added to registry.Info.Tags keys when they are
+// written into the instance properties
+func WithTagPrefix(prefix string) Option {
+	return func(o *options) {
+		o.tagPrefix = prefix
+	}
+}
+
+// ExistingInstancePolicy decides what Register does with an instance of the
+// same service version and endpoint which is already in ServiceComb.
+type ExistingInstancePolicy int
+
+const (
+	// ExistingInstanceIgnore registers a new instance beside the existing one.
+	ExistingInstanceIgnore ExistingInstancePolicy = iota
+	// ExistingInstanceReuse registers the instance with the existing instance id.
+	ExistingInstanceReuse
+	// ExistingInstanceReplace deregisters the existing instance first.
+	ExistingInstanceReplace
+)
+
+// SCRegistry is a ServiceComb registry which also manages the instances it registered.
+type SCRegistry interface {
+	registry.Registry
+	// Close stops all heartbeats and deregisters every instance registered
+	// by this registry. It returns when all of them are done or ctx is done.
+	Close(ctx context.Context) error
+	// UpdateStatus switches the status of an instance registered by this
+	// registry, the instance is found by info.ServiceName and info.Addr. An
+	// instance whose registration is in progress is registered with status.
+	UpdateStatus(info *registry.Info, status string) error
+}
+
 type serviceCombRegistry struct {
 	cli         *sc.Client
+	rest        *restClient
 	opts        options
 	lock        *sync.RWMutex
 	registryIns map[string]*scHeartbeat
+	scheduler   *heartbeatScheduler
+	closed      bool
 }
 
 // NewDefaultSCRegistry create a new default ServiceComb registry
-func NewDefaultSCRegistry(opts ...Option) (registry.Registry, error) {
+func NewDefaultSCRegistry(opts ...Option) (SCRegistry, error) {
 	client, err := servicecomb.NewDefaultSCClient()
 	if err != nil {
 		return nil, err
@@ -89,22 +338,37 @@ func NewDefaultSCRegistry(opts ...Option) (registry.Registry, error) {
 }
 
 // NewSCRegistry create a new ServiceComb registry
-func NewSCRegistry(client *sc.Client, opts ...Option) registry.Registry {
+func NewSCRegistry(client *sc.Client, opts ...Option) SCRegistry {
 	op := options{
 		appId:             "DEFAULT",
 		versionRule:       "1.0.0",
 		hostName:          "DEFAULT",
 		heartbeatInterval: 5,
+		maxBackoff:        30 * time.Second,
+		drainStatus:       servicecomb.StatusDown,
+		registerAttempts:  1,
+		registerBackoff:   minBackoff,
+		registerMaxDelay:  30 * time.Second,
+	}
+	if name, region, zone := servicecomb.SCDataCenter(); name != "" || region != "" || zone != "" {
+		op.dataCenter = &discovery.DataCenterInfo{Name: name, Region: region, AvailableZone: zone}
 	}
 	for _, opt := range opts {
 		opt(&op)
 	}
-	return &serviceCombRegistry{
+	if op.drainStatus != servicecomb.StatusDown && op.drainStatus != servicecomb.StatusOutOfService {
+		klog.Warnf("invalid drain status %q, use %s", op.drainStatus, servicecomb.StatusDown)
+		op.drainStatus = servicecomb.StatusDown
+	}
+	scr := &serviceCombRegistry{
 		cli:         client,
+		rest:        newRESTClient(client, op.tlsConfig),
 		opts:        op,
 		lock:        &sync.RWMutex{},
 		registryIns: make(map[string]*scHeartbeat),
 	}
+	scr.scheduler = newHeartbeatScheduler(scr)
+	return scr
 }
 
 // Register a service info to ServiceComb
@@ -118,35 +382,26 @@ func (scr *serviceCombRegistry) Register(info *registry.Info) error {
 	if info.Addr == nil {
 		return errors.New("registry.Info Addr can not be empty")
 	}
-	host, port, err := net.SplitHostPort(info.Addr.String())
+	endpoints, err := scr.endpoints(info.Addr)
 	if err != nil {
 		return fmt.Errorf("parse registry info addr error: %w", err)
 	}
-	if host == "" || host == "::" {
-		host, err = scr.getLocalIpv4Host()
-		if err != nil {
-			return fmt.Errorf("parse registry info addr error: %w", err)
-		}
-	}
 
-	instanceKey := fmt.Sprintf("%s:%s", info.ServiceName, info.Addr.String())
-	scr.lock.RLock()
-	_, ok := scr.registryIns[instanceKey]
-	scr.lock.RUnlock()
-	if ok {
-		return fmt.Errorf("instance{%s} already registered", instanceKey)
+	appId, version, environment := scr.serviceKey(info)
+	if !isValidEnvironment(environment) {
+		return fmt.Errorf("invalid service environment %q", environment)
 	}
-
-	serviceID, err := scr.cli.RegisterService(&discovery.MicroService{
-		ServiceName: info.ServiceName,
-		AppId:       scr.opts.appId,
-		Version:     scr.opts.versionRule,
-		Status:      sc.MSInstanceUP,
-	})
+	properties, err := scr.buildProperties(info)
 	if err != nil {
-		return fmt.Errorf("register service error: %w", err)
+		return err
+	}
+	instanceId := scr.opts.instanceId
+	if v, ok := info.Tags[servicecomb.TagInstanceId]; ok && v != "" {
+		instanceId = v
 	}
 
+	instanceKey := fmt.Sprintf("%s:%s", info.ServiceName, info.Addr.String())
+
 	healthCheck := &discovery.HealthCheck{
 		Mode:     "push",
 		Interval: 30,
@@ -156,120 +411,471 @@ func (scr *serviceCombRegistry) Register(info *registry.Info) error {
 		healthCheck.Interval = scr.opts.heartbeatInterval
 	}
 
-	instanceId, err := scr.cli.RegisterMicroServiceInstance(&discovery.MicroServiceInstance{
-		ServiceId:   serviceID,
-		Endpoints:   []string{host + ":" + port},
-		HostName:    scr.opts.hostName,
-		HealthCheck: healthCheck,
-		Status:      sc.MSInstanceUP,
-	})
-	if err != nil {
-		return fmt.Errorf("register service instance error: %w", err)
+	hb := &scHeartbeat{
+		instanceKey: instanceKey,
+		service: &discovery.MicroService{
+			ServiceName: info.ServiceName,
+			AppId:       appId,
+			Version:     version,
+			Environment: environment,
+			Description: scr.opts.description,
+			Level:       scr.opts.level,
+			Alias:       scr.opts.alias,
+			Properties:  scr.opts.serviceProperties,
+			Status:      sc.MSInstanceUP,
+		},
+		schemas: scr.opts.schemas[info.ServiceName],
+		instance: &discovery.MicroServiceInstance{
+			InstanceId:     instanceId,
+			Endpoints:      endpoints,
+			HostName:       scr.opts.hostName,
+			HealthCheck:    healthCheck,
+			Status:         sc.MSInstanceUP,
+			Properties:     properties,
+			DataCenterInfo: scr.opts.dataCenter,
+		},
+	}
+	for _, s := range hb.schemas {
+		hb.service.Schemas = append(hb.service.Schemas, s.id)
 	}
 
+	// reserve the instance key, so that Deregister and Close can cancel a
+	// registration which is still in progress
 	ctx, cancel := context.WithCancel(context.Background())
-	go scr.heartBeat(ctx, serviceID, instanceId)
-
+	hb.cancel = cancel
 	scr.lock.Lock()
-	defer scr.lock.Unlock()
-	scr.registryIns[instanceKey] = &scHeartbeat{
-		instanceKey: instanceKey,
-		cancel:      cancel,
+	if scr.closed {
+		scr.lock.Unlock()
+		cancel()
+		return errors.New("registry is closed")
+	}
+	if _, ok := scr.registryIns[instanceKey]; ok {
+		scr.lock.Unlock()
+		cancel()
+		return fmt.Errorf("instance{%s} already registered", instanceKey)
+	}
+	if other := scr.findByInstanceId(hb.service, instanceId); other != nil {
+		scr.lock.Unlock()
+		cancel()
+		return fmt.Errorf("instance id %s is already used by instance{%s}", instanceId, other.instanceKey)
+	}
+	scr.registryIns[instanceKey] = hb
+	scr.lock.Unlock()
+
+	if scr.opts.asyncRegister {
+		go func() {
+			if err := scr.startInstance(ctx, hb, 0, 0); err != nil {
+				klog.CtxErrorf(ctx, "register instance{%s} in background error:%v", instanceKey, err)
+			}
+		}()
+		return nil
 	}
+	if err = scr.startInstance(ctx, hb, scr.opts.registerAttempts, scr.opts.registerTimeout); err != nil {
+		scr.lock.Lock()
+		if scr.registryIns[instanceKey] == hb {
+			delete(scr.registryIns, instanceKey)
+		}
+		scr.lock.Unlock()
+		cancel()
+		return err
+	}
+	return nil
+}
 
+// findByInstanceId returns the instance of service registered with the stable
+// instanceId, the caller must hold the lock.
+func (scr *serviceCombRegistry) findByInstanceId(service *discovery.MicroService, instanceId string) *scHeartbeat {
+	if instanceId == "" {
+		return nil
+	}
+	for _, hb := range scr.registryIns {
+		s := hb.service
+		if hb.instance.InstanceId == instanceId && s.ServiceName == service.ServiceName && s.AppId == service.AppId &&
+			s.Version == service.Version && s.Environment == service.Environment {
+			return hb
+		}
+	}
 	return nil
 }
 
-// Deregister a service or an instance
-func (scr *serviceCombRegistry) Deregister(info *registry.Info) error {
-	serviceId, err := scr.cli.GetMicroServiceID(scr.opts.appId, info.ServiceName, scr.opts.versionRule, "")
+// resolveExisting handles an existing instance of serviceId with one of
+// endpoints according to the policy, and returns the instance id to reuse.
+func (scr *serviceCombRegistry) resolveExisting(serviceId string, endpoints []string) string {
+	if scr.opts.existingPolicy == ExistingInstanceIgnore {
+		return ""
+	}
+	instances, err := scr.cli.GetMicroServiceInstances("", serviceId)
 	if err != nil {
-		return fmt.Errorf("get service-id error: %w", err)
+		klog.Warnf("get instances of service %s error:%v, skip checking existing instances", serviceId, err)
+		return ""
 	}
-	if info.Addr == nil {
-		_, err = scr.cli.UnregisterMicroService(serviceId)
-		if err != nil {
-			return fmt.Errorf("deregister service error: %w", err)
+	existing := findInstanceByEndpoints(instances, endpoints)
+	if existing == nil {
+		return ""
+	}
+	if scr.opts.existingPolicy == ExistingInstanceReuse {
+		return existing.InstanceId
+	}
+	if _, err = scr.cli.UnregisterMicroServiceInstance(serviceId, existing.InstanceId); err != nil {
+		klog.Warnf("deregister existing instance %s error:%v", existing.InstanceId, err)
+	}
+	return ""
+}
+
+// findInstanceByEndpoints returns the first instance sharing an endpoint with endpoints.
+func findInstanceByEndpoints(instances []*discovery.MicroServiceInstance, endpoints []string) *discovery.MicroServiceInstance {
+	for _, instance := range instances {
+		for _, endpoint := range endpoints {
+			if funk.ContainsString(instance.Endpoints, endpoint) {
+				return instance
+			}
 		}
-	} else {
-		instanceKey := fmt.Sprintf("%s:%s", info.ServiceName, info.Addr.String())
+	}
+	return nil
+}
+
+// startInstance registers hb with retries and starts its heartbeats. An
+// instance registered after hb has been cancelled is removed right away.
+func (scr *serviceCombRegistry) startInstance(ctx context.Context, hb *scHeartbeat, attempts int, timeout time.Duration) error {
+	if err := scr.registerWithRetry(ctx, hb, attempts, timeout); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
 		scr.lock.RLock()
-		insHeartbeat, ok := scr.registryIns[instanceKey]
+		serviceId, instanceId := hb.serviceId, hb.instanceId
 		scr.lock.RUnlock()
-		if !ok {
-			return fmt.Errorf("instance{%s} has not registered", instanceKey)
+		if _, err := scr.cli.UnregisterMicroServiceInstance(serviceId, instanceId); err != nil {
+			return fmt.Errorf("instance{%s} is cancelled, deregister service error: %w", hb.instanceKey, err)
 		}
+		return fmt.Errorf("instance{%s} is cancelled", hb.instanceKey)
+	}
+	scr.scheduler.add(ctx, hb)
+	scr.emit(EventRegistered, hb, nil)
+	return nil
+}
 
-		host, port, err := net.SplitHostPort(info.Addr.String())
-		if err != nil {
-			return fmt.Errorf("parse deregistry info addr error: %w", err)
+// registerWithRetry calls registerInstance until it succeeds, attempts are
+// exhausted or timeout elapses. Zero attempts or timeout means no limit.
+func (scr *serviceCombRegistry) registerWithRetry(ctx context.Context, hb *scHeartbeat, attempts int, timeout time.Duration) error {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := scr.registerInstance(hb)
+		if err == nil {
+			return nil
 		}
-		if host == "" || host == "::" {
-			host, err = scr.getLocalIpv4Host()
-			if err != nil {
-				return fmt.Errorf("parse deregistry info addr error: %w", err)
-			}
+		scr.emit(EventRegisterFailed, hb, err)
+		elapsed := time.Since(start)
+		if (attempts > 0 && attempt >= attempts) || (timeout > 0 && elapsed >= timeout) {
+			return err
+		}
+		delay := expBackoff(attempt, scr.opts.registerBackoff, scr.opts.registerMaxDelay)
+		if timeout > 0 && delay > timeout-elapsed {
+			delay = timeout - elapsed
 		}
+		klog.CtxWarnf(ctx, "register instance{%s} error:%v, retry in %v", hb.instanceKey, err, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
 
-		addr := host + ":" + port
+// registerInstance registers the service and the instance of hb, and records
+// the ids returned by ServiceComb.
+func (scr *serviceCombRegistry) registerInstance(hb *scHeartbeat) error {
+	serviceId, err := scr.cli.RegisterService(hb.service)
+	if err != nil {
+		return fmt.Errorf("register service error: %w", err)
+	}
+	if err = scr.addSchemas(serviceId, hb); err != nil {
+		return err
+	}
 
-		instanceId := ""
-		instances, err := scr.cli.FindMicroServiceInstances("", scr.opts.appId, info.ServiceName, scr.opts.versionRule, sc.WithoutRevision())
-		if err != nil {
-			return fmt.Errorf("get instances error: %w", err)
-		}
-		for _, instance := range instances {
-			if funk.ContainsString(instance.Endpoints, addr) {
-				instanceId = instance.InstanceId
-			}
+	scr.lock.Lock()
+	hb.instance.ServiceId = serviceId
+	instance := *hb.instance
+	scr.lock.Unlock()
+	if instance.InstanceId == "" {
+		instance.InstanceId = scr.resolveExisting(serviceId, instance.Endpoints)
+	}
+	instanceId, err := scr.cli.RegisterMicroServiceInstance(&instance)
+	if err != nil {
+		return fmt.Errorf("register service instance error: %w", err)
+	}
+
+	scr.lock.Lock()
+	hb.serviceId = serviceId
+	hb.instanceId = instanceId
+	status := hb.instance.Status
+	scr.lock.Unlock()
+	// the status may have been updated while the instance was registered
+	if status != instance.Status {
+		if _, err = scr.cli.UpdateMicroServiceInstanceStatus(serviceId, instanceId, status); err != nil {
+			klog.Warnf("update instance{%s} status to %s error:%v", hb.instanceKey, status, err)
 		}
-		if instanceId != "" {
-			_, err = scr.cli.UnregisterMicroServiceInstance(serviceId, instanceId)
-			if err != nil {
-				return fmt.Errorf("deregister service error: %w", err)
-			}
+	}
+	return nil
+}
+
+// Deregister a service or an instance
+func (scr *serviceCombRegistry) Deregister(info *registry.Info) error {
+	if info == nil {
+		return errors.New("registry.Info can not be empty")
+	}
+	if info.Addr == nil {
+		return scr.deregisterService(info)
+	}
+
+	instanceKey := fmt.Sprintf("%s:%s", info.ServiceName, info.Addr.String())
+	scr.lock.Lock()
+	insHeartbeat, ok := scr.registryIns[instanceKey]
+	if !ok {
+		scr.lock.Unlock()
+		return scr.deregisterByEndpoint(info)
+	}
+	delete(scr.registryIns, instanceKey)
+	scr.lock.Unlock()
+
+	if err := scr.unregister(context.Background(), insHeartbeat); err != nil {
+		return fmt.Errorf("deregister service error: %w", err)
+	}
+	return nil
+}
+
+// unregister drains the instance of hb if configured, stops its heartbeat and
+// removes it from ServiceComb.
+func (scr *serviceCombRegistry) unregister(ctx context.Context, hb *scHeartbeat) error {
+	scr.lock.RLock()
+	registered := hb.instanceId != ""
+	scr.lock.RUnlock()
+	if !registered {
+		// the registration is still in progress and stops on cancel
+		hb.cancel()
+		return nil
+	}
+	if scr.opts.drainPeriod > 0 {
+		scr.drain(ctx, hb)
+	}
+	hb.cancel()
+
+	scr.lock.RLock()
+	serviceId, instanceId := hb.serviceId, hb.instanceId
+	scr.lock.RUnlock()
+	_, err := scr.cli.UnregisterMicroServiceInstance(serviceId, instanceId)
+	if err != nil && !isNotExistsError(err) {
+		return err
+	}
+	scr.emit(EventDeregistered, hb, nil)
+	return nil
+}
+
+// drain switches the instance to the drain status and waits for the drain
+// period, so that resolvers stop routing to it before it goes away.
+func (scr *serviceCombRegistry) drain(ctx context.Context, hb *scHeartbeat) {
+	scr.lock.Lock()
+	hb.instance.Status = scr.opts.drainStatus
+	serviceId, instanceId := hb.serviceId, hb.instanceId
+	scr.lock.Unlock()
+
+	_, err := scr.cli.UpdateMicroServiceInstanceStatus(serviceId, instanceId, scr.opts.drainStatus)
+	if err != nil {
+		klog.Warnf("update instance{%s} status to %s error:%v, deregister it directly", hb.instanceKey, scr.opts.drainStatus, err)
+		return
+	}
+	timer := time.NewTimer(scr.opts.drainPeriod)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// deregisterService removes the whole service, stopping the heartbeats of its
+// instances registered by this process first.
+func (scr *serviceCombRegistry) deregisterService(info *registry.Info) error {
+	appId, version, environment := scr.serviceKey(info)
+	serviceId, err := scr.cli.GetMicroServiceID(appId, info.ServiceName, version, environment)
+	if err != nil {
+		return fmt.Errorf("get service-id error: %w", err)
+	}
+	if serviceId == "" {
+		return fmt.Errorf("service %s/%s/%s does not exist", appId, info.ServiceName, version)
+	}
+
+	var heartbeats []*scHeartbeat
+	scr.lock.Lock()
+	for key, hb := range scr.registryIns {
+		if hb.serviceId == serviceId {
+			hb.cancel()
+			heartbeats = append(heartbeats, hb)
+			delete(scr.registryIns, key)
 		}
+	}
+	scr.lock.Unlock()
 
-		scr.lock.Lock()
-		insHeartbeat.cancel()
-		delete(scr.registryIns, instanceKey)
+	_, err = scr.cli.UnregisterMicroService(serviceId)
+	if err != nil {
+		return fmt.Errorf("deregister service error: %w", err)
+	}
+	for _, hb := range heartbeats {
+		scr.emit(EventDeregistered, hb, nil)
+	}
+	return nil
+}
+
+// deregisterByEndpoint searches ServiceComb for an instance which was not
+// registered by this process and removes it by its endpoint.
+func (scr *serviceCombRegistry) deregisterByEndpoint(info *registry.Info) error {
+	appId, version, environment := scr.serviceKey(info)
+	serviceId, err := scr.cli.GetMicroServiceID(appId, info.ServiceName, version, environment)
+	if err != nil {
+		return fmt.Errorf("get service-id error: %w", err)
+	}
+	if serviceId == "" {
+		return fmt.Errorf("service %s/%s/%s does not exist", appId, info.ServiceName, version)
+	}
+
+	endpoints, err := scr.endpoints(info.Addr)
+	if err != nil {
+		return fmt.Errorf("parse deregistry info addr error: %w", err)
+	}
+
+	instances, err := scr.cli.GetMicroServiceInstances("", serviceId)
+	if err != nil {
+		return fmt.Errorf("get instances error: %w", err)
+	}
+	instance := findInstanceByEndpoints(instances, endpoints)
+	if instance == nil {
+		return fmt.Errorf("instance{%s:%s} has not registered", info.ServiceName, info.Addr.String())
+	}
+	_, err = scr.cli.UnregisterMicroServiceInstance(serviceId, instance.InstanceId)
+	if err != nil {
+		return fmt.Errorf("deregister service error: %w", err)
+	}
+	return nil
+}
+
+// UpdateStatus switches a registered instance to one of the ServiceComb instance statuses.
+func (scr *serviceCombRegistry) UpdateStatus(info *registry.Info, status string) error {
+	if info == nil || info.Addr == nil {
+		return errors.New("registry.Info Addr can not be empty")
+	}
+	if !servicecomb.IsValidStatus(status) {
+		return fmt.Errorf("invalid instance status %q", status)
+	}
+	instanceKey := fmt.Sprintf("%s:%s", info.ServiceName, info.Addr.String())
+	scr.lock.Lock()
+	hb, ok := scr.registryIns[instanceKey]
+	if !ok {
 		scr.lock.Unlock()
+		return fmt.Errorf("instance{%s} has not registered", instanceKey)
+	}
+	hb.instance.Status = status
+	serviceId, instanceId := hb.serviceId, hb.instanceId
+	scr.lock.Unlock()
+	if instanceId == "" {
+		// the registration is still in progress and registers the new status
+		return nil
 	}
 
+	_, err := scr.cli.UpdateMicroServiceInstanceStatus(serviceId, instanceId, status)
+	if err != nil {
+		return fmt.Errorf("update instance{%s} status error: %w", instanceKey, err)
+	}
 	return nil
 }
 
-func (scr *serviceCombRegistry) heartBeat(ctx context.Context, serviceId, instanceId string) {
-	ticker := time.NewTicker(time.Second * time.Duration(scr.opts.heartbeatInterval))
-	for {
-		select {
-		case <-ctx.Done():
-			ticker.Stop()
-			return
-		case <-ticker.C:
-			success, err := scr.cli.Heartbeat(serviceId, instanceId)
-			if err != nil || !success {
-				klog.CtxErrorf(ctx, "beat to ServerComb return error:%+v instance:%v", err, instanceId)
-				ticker.Stop()
+// Close stops all heartbeats and deregisters every instance concurrently,
+// draining them first if configured.
+func (scr *serviceCombRegistry) Close(ctx context.Context) error {
+	defer scr.scheduler.stop()
+	scr.lock.Lock()
+	scr.closed = true
+	heartbeats := make([]*scHeartbeat, 0, len(scr.registryIns))
+	for key, hb := range scr.registryIns {
+		heartbeats = append(heartbeats, hb)
+		delete(scr.registryIns, key)
+	}
+	scr.lock.Unlock()
+
+	errCh := make(chan error, len(heartbeats))
+	for _, hb := range heartbeats {
+		go func(hb *scHeartbeat) {
+			if err := scr.unregister(ctx, hb); err != nil {
+				errCh <- fmt.Errorf("deregister instance{%s} error: %w", hb.instanceKey, err)
 				return
 			}
+			errCh <- nil
+		}(hb)
+	}
+
+	var errs []string
+	for range heartbeats {
+		select {
+		case err := <-errCh:
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+		case <-ctx.Done():
+			errs = append(errs, fmt.Sprintf("close registry interrupted: %v", ctx.Err()))
+			return fmt.Errorf("close registry error: %s", strings.Join(errs, "; "))
 		}
 	}
+	if len(errs) > 0 {
+		return fmt.Errorf("close registry error: %s", strings.Join(errs, "; "))
+	}
+	return nil
 }
 
-func (scr *serviceCombRegistry) getLocalIpv4Host() (string, error) {
-	addr, err := net.InterfaceAddrs()
-	if err != nil {
-		return "", err
-	}
-	for _, addr := range addr {
-		ipNet, isIpNet := addr.(*net.IPNet)
-		if isIpNet && !ipNet.IP.IsLoopback() {
-			ipv4 := ipNet.IP.To4()
-			if ipv4 != nil {
-				return ipv4.String(), nil
-			}
+// serviceKey returns the appId, version and environment of info, the
+// well-known tags of info override the registry options.
+func (scr *serviceCombRegistry) serviceKey(info *registry.Info) (appId, version, environment string) {
+	appId, version, environment = scr.opts.appId, scr.opts.versionRule, scr.opts.environment
+	if v, ok := info.Tags[servicecomb.TagAppId]; ok && v != "" {
+		appId = v
+	}
+	if v, ok := info.Tags[servicecomb.TagVersion]; ok && v != "" {
+		version = v
+	}
+	if v, ok := info.Tags[servicecomb.TagEnvironment]; ok {
+		environment = v
+	}
+	return appId, version, environment
+}
+
+func isValidEnvironment(environment string) bool {
+	switch environment {
+	case "", discovery.ENV_DEV, discovery.ENV_TEST, discovery.ENV_ACCEPT, discovery.ENV_PROD:
+		return true
+	}
+	return false
+}
+
+// buildProperties converts registry.Info.Tags and Weight into instance properties.
+func (scr *serviceCombRegistry) buildProperties(info *registry.Info) (map[string]string, error) {
+	if info.Weight < 0 {
+		return nil, fmt.Errorf("registry.Info Weight can not be negative: %d", info.Weight)
+	}
+	properties := make(map[string]string, len(info.Tags)+1)
+	for k, v := range info.Tags {
+		if k == servicecomb.TagAppId || k == servicecomb.TagVersion || k == servicecomb.TagEnvironment ||
+			k == servicecomb.TagInstanceId {
+			continue
+		}
+		if k == "" {
+			return nil, errors.New("registry.Info Tags can not contain an empty key")
 		}
+		key := scr.opts.tagPrefix + k
+		if servicecomb.IsReservedProperty(key) {
+			return nil, fmt.Errorf("registry.Info tag %q uses the reserved prefix %q", key, servicecomb.ReservedPropertyPrefix)
+		}
+		properties[key] = v
+	}
+	if info.Weight > 0 {
+		properties[servicecomb.PropertyWeight] = strconv.Itoa(info.Weight)
 	}
-	return "", errors.New("not found ipv4 address")
+	return properties, nil
 }
@@ -15,12 +15,20 @@
 package registry
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/go-chassis/cari/discovery"
 	"github.com/go-chassis/sc-client"
+	"github.com/kitex-contrib/registry-servicecomb/servicecomb"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -165,3 +173,344 @@ func TestSCMultipleInstances(t *testing.T) {
 	_, err = client.FindMicroServiceInstances("", AppId, ServiceName, LatestVersion, sc.WithoutRevision())
 	assert.Nil(t, err)
 }
+
+// test registry.Info tags are converted into instance properties
+func TestSCRegistryBuildProperties(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		tags    map[string]string
+		weight  int
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "common",
+			tags: map[string]string{"lane": "blue"},
+			want: map[string]string{"lane": "blue"},
+		},
+		{
+			name:   "prefix",
+			prefix: "tag.",
+			tags:   map[string]string{"lane": "blue"},
+			want:   map[string]string{"tag.lane": "blue"},
+		},
+		{
+			name:    "empty key",
+			tags:    map[string]string{"": "blue"},
+			wantErr: true,
+		},
+		{
+			name:    "reserved key",
+			tags:    map[string]string{"kitex.weight": "10"},
+			wantErr: true,
+		},
+		{
+			name: "service tags",
+			tags: map[string]string{"app_id": "demo", "version": "2.0.0", "lane": "blue"},
+			want: map[string]string{"lane": "blue"},
+		},
+		{
+			name:   "weight",
+			weight: 20,
+			want:   map[string]string{"kitex.weight": "20"},
+		},
+		{
+			name:    "negative weight",
+			weight:  -1,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scr := NewSCRegistry(nil, WithTagPrefix(tt.prefix)).(*serviceCombRegistry)
+			got, err := scr.buildProperties(&registry.Info{ServiceName: ServiceName, Tags: tt.tags, Weight: tt.weight})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("buildProperties() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+// test a closed registry refuses new registrations
+func TestSCRegistryClose(t *testing.T) {
+	got := NewSCRegistry(nil, WithAppId(AppId), WithVersionRule(Version))
+	assert.Nil(t, got.Close(context.Background()))
+	err := got.Register(&registry.Info{
+		ServiceName: ServiceName,
+		Addr:        &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8084},
+	})
+	assert.NotNil(t, err)
+}
+
+// test updating the status of an instance
+func TestSCRegistryUpdateStatus(t *testing.T) {
+	got := NewSCRegistry(nil, WithAppId(AppId), WithVersionRule(Version))
+	info := &registry.Info{
+		ServiceName: ServiceName,
+		Addr:        &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8085},
+	}
+	assert.NotNil(t, got.UpdateStatus(info, "UNKNOWN"))
+	assert.NotNil(t, got.UpdateStatus(info, servicecomb.StatusOutOfService))
+}
+
+// test updating the status of an instance whose registration is in progress
+func TestSCRegistryUpdateStatusRegistering(t *testing.T) {
+	fake, client := newFakeSC(t)
+	scr := NewSCRegistry(client).(*serviceCombRegistry)
+	info := &registry.Info{
+		ServiceName: ServiceName,
+		Addr:        &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8085},
+	}
+	hb := &scHeartbeat{instance: &discovery.MicroServiceInstance{Status: servicecomb.StatusUp}}
+	scr.registryIns[ServiceName+":"+info.Addr.String()] = hb
+	assert.Nil(t, scr.UpdateStatus(info, servicecomb.StatusTesting))
+	assert.Equal(t, servicecomb.StatusTesting, hb.instance.Status)
+	assert.Empty(t, fake.calls())
+}
+
+// test instances are switched to the drain status before they are deregistered
+func TestSCRegistryDrain(t *testing.T) {
+	fake, client := newFakeSC(t)
+	scr := NewSCRegistry(client, WithDrain(servicecomb.StatusUp, 10*time.Millisecond)).(*serviceCombRegistry)
+	assert.Equal(t, servicecomb.StatusDown, scr.opts.drainStatus)
+
+	scr = NewSCRegistry(client, WithDrain(servicecomb.StatusOutOfService, 10*time.Millisecond)).(*serviceCombRegistry)
+	info := &registry.Info{
+		ServiceName: ServiceName,
+		Addr:        &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8087},
+	}
+	assert.Nil(t, scr.Register(info))
+	assert.Nil(t, scr.Deregister(info))
+
+	status := fake.requestsOf("PUT", "/status")
+	assert.Len(t, status, 1)
+	assert.Equal(t, "value=OUTOFSERVICE", status[0].query)
+	calls := fake.calls()
+	assert.Equal(t, []string{"PUT /microservices/s1/instances/i1/status", "DELETE /microservices/s1/instances/i1"}, calls[len(calls)-2:])
+}
+
+// test failed registrations are retried up to the max attempts
+func TestSCRegistryRegisterRetry(t *testing.T) {
+	fake, client := newFakeSC(t)
+	fake.setHook(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		w.WriteHeader(http.StatusInternalServerError)
+		return true
+	})
+	var failures int32
+	scr := NewSCRegistry(client, WithRegisterRetry(3, 0), WithRegisterBackoff(time.Millisecond, 2*time.Millisecond),
+		WithListener(func(event Event) {
+			if event.Type == EventRegisterFailed {
+				atomic.AddInt32(&failures, 1)
+			}
+		}))
+	info := &registry.Info{
+		ServiceName: ServiceName,
+		Addr:        &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8088},
+	}
+	assert.NotNil(t, scr.Register(info))
+	assert.Len(t, fake.requestsOf("POST", "/microservices"), 3)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&failures))
+	// the failed instance is not kept
+	assert.NotNil(t, scr.Register(info))
+	assert.Len(t, fake.requestsOf("POST", "/microservices"), 6)
+}
+
+// test the registration retries stop at the timeout, even within a backoff
+func TestSCRegistryRegisterTimeout(t *testing.T) {
+	fake, client := newFakeSC(t)
+	fake.setHook(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		w.WriteHeader(http.StatusInternalServerError)
+		return true
+	})
+	scr := NewSCRegistry(client, WithRegisterRetry(0, 100*time.Millisecond), WithRegisterBackoff(time.Minute, time.Minute))
+	start := time.Now()
+	err := scr.Register(&registry.Info{
+		ServiceName: ServiceName,
+		Addr:        &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8089},
+	})
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second, "elapsed:%v", time.Since(start))
+	assert.Len(t, fake.requestsOf("POST", "/microservices"), 2)
+}
+
+// test async registration keeps retrying in background and reports failures
+func TestSCRegistryAsyncRegister(t *testing.T) {
+	fake, client := newFakeSC(t)
+	var attempts int32
+	fake.setHook(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/microservices") && atomic.AddInt32(&attempts, 1) <= 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return true
+		}
+		return false
+	})
+	events := make(chan Event, 10)
+	scr := NewSCRegistry(client, WithAsyncRegister(), WithRegisterBackoff(time.Millisecond, 2*time.Millisecond),
+		WithListener(func(event Event) { events <- event }))
+	info := &registry.Info{
+		ServiceName: ServiceName,
+		Addr:        &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8090},
+	}
+	assert.Nil(t, scr.Register(info))
+	var types []EventType
+	for len(types) < 3 {
+		select {
+		case event := <-events:
+			types = append(types, event.Type)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("events:%v", types)
+		}
+	}
+	assert.Equal(t, []EventType{EventRegisterFailed, EventRegisterFailed, EventRegistered}, types)
+	assert.Nil(t, scr.Close(context.Background()))
+}
+
+// test stable instance ids are not shared by instances of a service
+func TestSCRegistryInstanceId(t *testing.T) {
+	fake, client := newFakeSC(t)
+	scr := NewSCRegistry(client, WithInstanceId("pod-1"))
+	assert.Nil(t, scr.Register(&registry.Info{
+		ServiceName: ServiceName,
+		Addr:        &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8091},
+	}))
+	assert.NotNil(t, scr.Register(&registry.Info{
+		ServiceName: ServiceName,
+		Addr:        &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8092},
+	}))
+	assert.Nil(t, scr.Register(&registry.Info{
+		ServiceName: ServiceName,
+		Addr:        &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8093},
+		Tags:        map[string]string{servicecomb.TagInstanceId: "pod-1-8093"},
+	}))
+	assert.Nil(t, scr.Close(context.Background()))
+
+	var ids []string
+	for _, r := range fake.requestsOf("POST", "/instances") {
+		var body discovery.RegisterInstanceRequest
+		assert.Nil(t, json.Unmarshal([]byte(r.body), &body))
+		ids = append(ids, body.Instance.InstanceId)
+		_, ok := body.Instance.Properties[servicecomb.TagInstanceId]
+		assert.False(t, ok)
+	}
+	assert.Equal(t, []string{"pod-1", "pod-1-8093"}, ids)
+	// existing instances are only looked up on demand
+	assert.Empty(t, fake.requestsOf("GET", "/instances"))
+}
+
+// test an existing instance with the same endpoint is reused on demand
+func TestSCRegistryExistingInstanceReuse(t *testing.T) {
+	fake, client := newFakeSC(t)
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8094}
+	previous := NewSCRegistry(client)
+	defer previous.Close(context.Background())
+	assert.Nil(t, previous.Register(&registry.Info{ServiceName: ServiceName, Addr: addr}))
+
+	scr := NewSCRegistry(client, WithExistingInstancePolicy(ExistingInstanceReuse))
+	defer scr.Close(context.Background())
+	assert.Nil(t, scr.Register(&registry.Info{ServiceName: ServiceName, Addr: addr}))
+	lookups := fake.requestsOf("GET", "/microservices/s1/instances")
+	assert.Len(t, lookups, 1)
+	assert.Equal(t, "", lookups[0].consumerId)
+	registers := fake.requestsOf("POST", "/microservices/s1/instances")
+	var body discovery.RegisterInstanceRequest
+	assert.Nil(t, json.Unmarshal([]byte(registers[1].body), &body))
+	assert.Equal(t, "i1", body.Instance.InstanceId)
+}
+
+// test deregistering an unknown service keeps the registrations in progress
+func TestSCRegistryDeregisterUnknownService(t *testing.T) {
+	_, client := newFakeSC(t)
+	scr := NewSCRegistry(client).(*serviceCombRegistry)
+	hb := &scHeartbeat{
+		cancel:   func() {},
+		service:  &discovery.MicroService{ServiceName: ServiceName},
+		instance: &discovery.MicroServiceInstance{},
+	}
+	scr.registryIns[ServiceName+":127.0.0.1:8096"] = hb
+	assert.NotNil(t, scr.Deregister(&registry.Info{ServiceName: ServiceName}))
+	assert.NotNil(t, scr.Deregister(&registry.Info{
+		ServiceName: ServiceName,
+		Addr:        &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8097},
+	}))
+	assert.Equal(t, hb, scr.registryIns[ServiceName+":127.0.0.1:8096"])
+}
+
+// test an instance of another process is deregistered by its endpoint
+func TestSCRegistryDeregisterByEndpoint(t *testing.T) {
+	fake, client := newFakeSC(t)
+	fake.setHook(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		if strings.HasSuffix(r.URL.Path, "/existence") {
+			assert.Equal(t, "testing", r.URL.Query().Get("env"))
+			writeJSON(w, &discovery.GetExistenceResponse{ServiceId: "s1"})
+			return true
+		}
+		return false
+	})
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8098}
+	other := NewSCRegistry(client, WithEnvironment("testing"))
+	defer other.Close(context.Background())
+	assert.Nil(t, other.Register(&registry.Info{ServiceName: ServiceName, Addr: addr}))
+
+	scr := NewSCRegistry(client, WithEnvironment("testing"))
+	assert.Nil(t, scr.Deregister(&registry.Info{ServiceName: ServiceName, Addr: addr}))
+	assert.Len(t, fake.requestsOf("GET", "/microservices/s1/instances"), 1)
+	assert.Len(t, fake.requestsOf("DELETE", "/microservices/s1/instances/i1"), 1)
+}
+
+// test an unknown environment is refused
+func TestSCRegistryEnvironment(t *testing.T) {
+	assert.True(t, isValidEnvironment(""))
+	assert.True(t, isValidEnvironment("production"))
+	got := NewSCRegistry(nil, WithEnvironment("staging"))
+	err := got.Register(&registry.Info{
+		ServiceName: ServiceName,
+		Addr:        &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8086},
+	})
+	assert.NotNil(t, err)
+}
+
+// test listeners receive instance events
+func TestSCRegistryListener(t *testing.T) {
+	var events []Event
+	scr := NewSCRegistry(nil, WithListener(func(event Event) {
+		events = append(events, event)
+	})).(*serviceCombRegistry)
+	hb := &scHeartbeat{
+		service:    &discovery.MicroService{ServiceName: ServiceName},
+		instanceId: "instance-1",
+	}
+	scr.emit(EventHeartbeatFailed, hb, errors.New("timeout"))
+	assert.Equal(t, []Event{{
+		Type:        EventHeartbeatFailed,
+		ServiceName: ServiceName,
+		InstanceId:  "instance-1",
+		Err:         errors.New("timeout"),
+	}}, events)
+}
+
+// test finding an existing instance by its endpoints
+func TestFindInstanceByEndpoints(t *testing.T) {
+	instances := []*discovery.MicroServiceInstance{
+		{InstanceId: "1", Endpoints: []string{"127.0.0.1:8081"}},
+		{InstanceId: "2", Endpoints: []string{"127.0.0.1:8082", "[::1]:8082"}},
+	}
+	assert.Equal(t, "2", findInstanceByEndpoints(instances, []string{"[::1]:8082"}).InstanceId)
+	assert.Nil(t, findInstanceByEndpoints(instances, []string{"127.0.0.1:8083"}))
+}
+
+// test well-known tags override the registry options
+func TestSCRegistryServiceKey(t *testing.T) {
+	scr := NewSCRegistry(nil, WithAppId(AppId), WithVersionRule(Version), WithEnvironment("testing")).(*serviceCombRegistry)
+	appId, version, environment := scr.serviceKey(&registry.Info{ServiceName: ServiceName})
+	assert.Equal(t, []string{AppId, Version, "testing"}, []string{appId, version, environment})
+	appId, version, environment = scr.serviceKey(&registry.Info{
+		ServiceName: ServiceName,
+		Tags:        map[string]string{"app_id": "demo", "version": "2.0.0", "environment": "production"},
+	})
+	assert.Equal(t, []string{"demo", "2.0.0", "production"}, []string{appId, version, environment})
+}
@@ -0,0 +1,103 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/go-chassis/sc-client"
+)
+
+const restTimeout = 10 * time.Second
+
+// restClient sends the ServiceComb requests which sc.Client does not offer,
+// to the same ServiceComb addresses and with the same headers as sc.Client.
+type restClient struct {
+	cli        *sc.Client
+	httpClient *http.Client
+}
+
+func newRESTClient(cli *sc.Client, tlsConfig *tls.Config) *restClient {
+	return &restClient{
+		cli: cli,
+		httpClient: &http.Client{
+			Timeout:   restTimeout,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+		},
+	}
+}
+
+// statusError is returned by do when ServiceComb answers with an error status.
+type statusError struct {
+	method string
+	api    string
+	code   int
+	body   []byte
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s %s failed, response StatusCode: %d, response body: %s", e.method, e.api, e.code, e.body)
+}
+
+// do sends request as JSON to api under the registry API path. The response
+// body is decoded into response when it is not nil, even if the status code
+// reports an error.
+func (c *restClient) do(method, api string, request, response interface{}) error {
+	if c.cli == nil {
+		return errors.New("ServiceComb client can not be empty")
+	}
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return err
+		}
+	}
+	protocol := "http"
+	if c.cli.Config != nil && c.cli.Config.SSL {
+		protocol = "https"
+	}
+	url := fmt.Sprintf("%s://%s%s%s", protocol, sc.GetInstance().GetAvailableAddress(), sc.MSAPIPath, api)
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = c.cli.GetDefaultHeaders()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if response != nil && len(bytes.TrimSpace(body)) > 0 {
+		if err = json.Unmarshal(body, response); err != nil && resp.StatusCode < 300 {
+			return err
+		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &statusError{method: method, api: api, code: resp.StatusCode, body: body}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type beatState struct {
+	ctx      context.Context
+	next     time.Time
+	failures int
+	// reRegistering is set while the instance is registered again outside
+	// of the rounds
+	reRegistering bool
+}
+
+// heartbeatScheduler sends the heartbeats of all instances of a registry from
+// a single goroutine. The healthy instances are beaten together on a shared
+// jittered tick, with one batch heartbeat request to ServiceComb per round.
+// Instances whose heartbeat failed are retried on their own backoff, and
+// rejoin the shared tick once they recover.
+type heartbeatScheduler struct {
+	scr       *serviceCombRegistry
+	lock      sync.Mutex
+	entries   map[*scHeartbeat]*beatState
+	nextRound time.Time
+	wake      chan struct{}
+	once      sync.Once
+	stopCh    chan struct{}
+}
+
+func newHeartbeatScheduler(scr *serviceCombRegistry) *heartbeatScheduler {
+	return &heartbeatScheduler{
+		scr:     scr,
+		entries: make(map[*scHeartbeat]*beatState),
+		wake:    make(chan struct{}, 1),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// add schedules the heartbeats of hb until ctx is done, in the next round.
+func (s *heartbeatScheduler) add(ctx context.Context, hb *scHeartbeat) {
+	s.once.Do(func() { go s.run() })
+	s.lock.Lock()
+	s.entries[hb] = &beatState{ctx: ctx}
+	if now := time.Now(); s.nextRound.Before(now) {
+		s.nextRound = now.Add(s.scr.heartbeatDelay())
+	}
+	s.lock.Unlock()
+	s.notify()
+}
+
+// stop stops the scheduler goroutine.
+func (s *heartbeatScheduler) stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	select {
+	case <-s.stopCh:
+	default:
+		close(s.stopCh)
+	}
+}
+
+func (s *heartbeatScheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *heartbeatScheduler) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		timer.Reset(s.nextDelay())
+		select {
+		case <-s.stopCh:
+			return
+		case <-s.wake:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			continue
+		case <-timer.C:
+		}
+		s.round()
+	}
+}
+
+// nextDelay drops cancelled entries and returns the delay until the next
+// round or the earliest due retry.
+func (s *heartbeatScheduler) nextDelay() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delay := time.Hour
+	now := time.Now()
+	for hb, state := range s.entries {
+		if state.ctx.Err() != nil {
+			delete(s.entries, hb)
+			continue
+		}
+		if state.reRegistering {
+			continue
+		}
+		next := s.nextRound
+		if state.failures > 0 {
+			next = state.next
+		}
+		if d := next.Sub(now); d < delay {
+			delay = d
+		}
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return delay
+}
+
+// round beats the healthy instances when the shared tick is due, together
+// with the failed instances whose retry is due, and handles their results.
+func (s *heartbeatScheduler) round() {
+	now := time.Now()
+	s.lock.Lock()
+	roundDue := !now.Before(s.nextRound)
+	if roundDue {
+		s.nextRound = now.Add(s.scr.heartbeatDelay())
+	}
+	var due []*scHeartbeat
+	states := make(map[*scHeartbeat]*beatState)
+	for hb, state := range s.entries {
+		if state.ctx.Err() != nil || state.reRegistering {
+			continue
+		}
+		if (state.failures == 0 && roundDue) || (state.failures > 0 && !state.next.After(now)) {
+			due = append(due, hb)
+			states[hb] = state
+		}
+	}
+	s.lock.Unlock()
+	if len(due) == 0 {
+		return
+	}
+
+	results := s.scr.beatAll(due)
+	for _, hb := range due {
+		state, err := states[hb], results[hb]
+		if err != nil && isNotExistsError(err) {
+			// registering again takes several requests, do not hold the
+			// heartbeats of the other instances for it
+			s.lock.Lock()
+			state.reRegistering = true
+			s.lock.Unlock()
+			go s.handle(hb, state, err)
+			continue
+		}
+		s.handle(hb, state, err)
+	}
+}
+
+// handle applies the heartbeat result err to the schedule of hb.
+func (s *heartbeatScheduler) handle(hb *scHeartbeat, state *beatState, err error) {
+	s.lock.Lock()
+	failures := state.failures
+	s.lock.Unlock()
+	failures, delay := s.scr.heartBeat(state.ctx, hb, failures, err)
+	s.lock.Lock()
+	state.failures = failures
+	state.next = time.Now().Add(delay)
+	state.reRegistering = false
+	s.lock.Unlock()
+	s.notify()
+}
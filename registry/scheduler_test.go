@@ -0,0 +1,99 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/go-chassis/cari/discovery"
+	"github.com/stretchr/testify/assert"
+)
+
+// test the heartbeat delay is jittered around the interval
+func TestSCRegistryHeartbeatDelay(t *testing.T) {
+	scr := NewSCRegistry(nil, WithHeartbeatInterval(10)).(*serviceCombRegistry)
+	for i := 0; i < 100; i++ {
+		got := scr.heartbeatDelay()
+		assert.True(t, got >= 9*time.Second && got <= 11*time.Second, "delay:%v", got)
+	}
+}
+
+// test cancelled instances are dropped from the scheduler
+func TestHeartbeatScheduler(t *testing.T) {
+	scr := NewSCRegistry(nil, WithHeartbeatInterval(10)).(*serviceCombRegistry)
+	s := scr.scheduler
+	defer s.stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hb := &scHeartbeat{instanceKey: "demo:127.0.0.1:8080"}
+	s.add(ctx, hb)
+	assert.True(t, s.nextDelay() > 8*time.Second)
+
+	cancel()
+	assert.Equal(t, time.Hour, s.nextDelay())
+	s.lock.Lock()
+	assert.Empty(t, s.entries)
+	s.lock.Unlock()
+}
+
+// test the healthy instances are beaten together with one request per round
+func TestHeartbeatSchedulerRounds(t *testing.T) {
+	fake, client := newFakeSC(t)
+	scr := NewSCRegistry(client, WithHeartbeatInterval(1))
+	for port := 8101; port <= 8103; port++ {
+		assert.Nil(t, scr.Register(&registry.Info{
+			ServiceName: ServiceName,
+			Addr:        &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port},
+		}))
+	}
+	time.Sleep(3500 * time.Millisecond)
+	assert.Nil(t, scr.Close(context.Background()))
+
+	requests := fake.requestsOf("PUT", "/heartbeats")
+	assert.True(t, len(requests) >= 2 && len(requests) <= 4, "requests:%d", len(requests))
+	for _, r := range requests {
+		var body discovery.HeartbeatSetRequest
+		assert.Nil(t, json.Unmarshal([]byte(r.body), &body))
+		assert.Len(t, body.Instances, 3)
+	}
+}
+
+// test a failed instance is retried on its own and rejoins the shared rounds
+func TestHeartbeatSchedulerRetry(t *testing.T) {
+	scr := NewSCRegistry(nil, WithHeartbeatInterval(10)).(*serviceCombRegistry)
+	s := scr.scheduler
+	defer s.stop()
+	ctx := context.Background()
+	healthy := &scHeartbeat{instanceKey: "demo:127.0.0.1:8080"}
+	failed := &scHeartbeat{instanceKey: "demo:127.0.0.1:8081"}
+	s.add(ctx, healthy)
+	s.add(ctx, failed)
+	s.lock.Lock()
+	s.entries[failed].failures = 1
+	s.entries[failed].next = time.Now().Add(time.Second)
+	s.lock.Unlock()
+	delay := s.nextDelay()
+	assert.True(t, delay > 0 && delay <= time.Second, "delay:%v", delay)
+
+	s.lock.Lock()
+	s.entries[failed].reRegistering = true
+	s.lock.Unlock()
+	assert.True(t, s.nextDelay() > 8*time.Second)
+}
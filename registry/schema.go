@@ -0,0 +1,85 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/cloudwego/kitex/pkg/serviceinfo"
+	"github.com/go-chassis/cari/discovery"
+)
+
+type schema struct {
+	id      string
+	content string
+}
+
+// WithSchema with a schema attached to the service named serviceName, the
+// content is usually the Thrift or Protobuf IDL of the service. Its summary is
+// the sha256 of the content.
+func WithSchema(serviceName, schemaId, content string) Option {
+	return func(o *options) {
+		if o.schemas == nil {
+			o.schemas = make(map[string][]schema)
+		}
+		o.schemas[serviceName] = append(o.schemas[serviceName], schema{id: schemaId, content: content})
+	}
+}
+
+// MethodListSchema generates a schema content listing the methods of svcInfo,
+// for services whose IDL is not available at runtime.
+func MethodListSchema(svcInfo *serviceinfo.ServiceInfo) string {
+	methods := make([]string, 0, len(svcInfo.Methods))
+	for name := range svcInfo.Methods {
+		methods = append(methods, name)
+	}
+	sort.Strings(methods)
+
+	codec := "thrift"
+	if svcInfo.PayloadCodec == serviceinfo.Protobuf {
+		codec = "protobuf"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s service %s\n", codec, svcInfo.ServiceName)
+	for _, method := range methods {
+		sb.WriteString(method)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// addSchemas uploads the schemas of hb to the service serviceId. They are sent
+// in a single request, which replaces all schemas of the service in ServiceComb.
+func (scr *serviceCombRegistry) addSchemas(serviceId string, hb *scHeartbeat) error {
+	if len(hb.schemas) == 0 {
+		return nil
+	}
+	request := &discovery.ModifySchemasRequest{Schemas: make([]*discovery.Schema, 0, len(hb.schemas))}
+	for _, s := range hb.schemas {
+		request.Schemas = append(request.Schemas, &discovery.Schema{
+			SchemaId: s.id,
+			Schema:   s.content,
+			Summary:  fmt.Sprintf("%x", sha256.Sum256([]byte(s.content))),
+		})
+	}
+	if err := scr.rest.do(http.MethodPost, "/microservices/"+serviceId+"/schemas", request, nil); err != nil {
+		return fmt.Errorf("add schemas error: %w", err)
+	}
+	return nil
+}
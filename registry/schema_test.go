@@ -0,0 +1,70 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/cloudwego/kitex/pkg/serviceinfo"
+	"github.com/go-chassis/cari/discovery"
+	"github.com/stretchr/testify/assert"
+)
+
+// test generating a method list schema
+func TestMethodListSchema(t *testing.T) {
+	svcInfo := &serviceinfo.ServiceInfo{
+		ServiceName: "Hello",
+		Methods: map[string]serviceinfo.MethodInfo{
+			"Echo": nil,
+			"Add":  nil,
+		},
+	}
+	assert.Equal(t, "# thrift service Hello\nAdd\nEcho\n", MethodListSchema(svcInfo))
+}
+
+// test schemas are grouped by service name
+func TestWithSchema(t *testing.T) {
+	scr := NewSCRegistry(nil, WithSchema("Hello", "hello.thrift", "service Hello {}"),
+		WithSchema("Hello", "methods", "Echo\n")).(*serviceCombRegistry)
+	assert.Equal(t, []schema{{id: "hello.thrift", content: "service Hello {}"}, {id: "methods", content: "Echo\n"}},
+		scr.opts.schemas["Hello"])
+}
+
+// test all schemas of a service are uploaded in a single request
+func TestSCRegistryAddSchemas(t *testing.T) {
+	fake, client := newFakeSC(t)
+	scr := NewSCRegistry(client, WithSchema("Hello", "hello.thrift", "service Hello {}"),
+		WithSchema("Hello", "methods", "Echo\n")).(*serviceCombRegistry)
+	assert.Nil(t, scr.addSchemas("s1", &scHeartbeat{schemas: scr.opts.schemas["Hello"]}))
+
+	requests := fake.requestsOf("POST", "/microservices/s1/schemas")
+	assert.Len(t, requests, 1)
+	var body discovery.ModifySchemasRequest
+	assert.Nil(t, json.Unmarshal([]byte(requests[0].body), &body))
+	assert.Equal(t, []*discovery.Schema{
+		{SchemaId: "hello.thrift", Schema: "service Hello {}", Summary: fmt.Sprintf("%x", sha256.Sum256([]byte("service Hello {}")))},
+		{SchemaId: "methods", Schema: "Echo\n", Summary: fmt.Sprintf("%x", sha256.Sum256([]byte("Echo\n")))},
+	}, body.Schemas)
+
+	fake.setHook(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		w.WriteHeader(http.StatusBadRequest)
+		return true
+	})
+	assert.NotNil(t, scr.addSchemas("s1", &scHeartbeat{schemas: scr.opts.schemas["Hello"]}))
+}
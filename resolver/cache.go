@@ -0,0 +1,75 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"sync"
+	"time"
+
+	scdiscovery "github.com/go-chassis/cari/discovery"
+	"github.com/kitex-contrib/registry-servicecomb/servicecomb"
+)
+
+// staleCache keeps the last successful query result of every service, to be
+// served while ServiceComb is unavailable.
+type staleCache struct {
+	lock    sync.RWMutex
+	maxAge  time.Duration
+	entries map[string]staleEntry
+}
+
+type staleEntry struct {
+	instances []*scdiscovery.MicroServiceInstance
+	updated   time.Time
+}
+
+func newStaleCache(maxAge time.Duration) *staleCache {
+	return &staleCache{
+		maxAge:  maxAge,
+		entries: make(map[string]staleEntry),
+	}
+}
+
+func (c *staleCache) set(desc string, instances []*scdiscovery.MicroServiceInstance) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries[desc] = staleEntry{instances: instances, updated: time.Now()}
+}
+
+// get returns the last known instances of desc if they are not older than maxAge.
+func (c *staleCache) get(desc string) ([]*scdiscovery.MicroServiceInstance, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	entry, ok := c.entries[desc]
+	if !ok || time.Since(entry.updated) > c.maxAge {
+		return nil, false
+	}
+	return entry.instances, true
+}
+
+// markStale copies the instances with the stale property added.
+func markStale(instances []*scdiscovery.MicroServiceInstance) []*scdiscovery.MicroServiceInstance {
+	stale := make([]*scdiscovery.MicroServiceInstance, 0, len(instances))
+	for _, in := range instances {
+		copied := *in
+		copied.Properties = make(map[string]string, len(in.Properties)+1)
+		for k, v := range in.Properties {
+			copied.Properties[k] = v
+		}
+		copied.Properties[servicecomb.PropertyStale] = "true"
+		stale = append(stale, &copied)
+	}
+	return stale
+}
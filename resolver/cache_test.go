@@ -0,0 +1,43 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"testing"
+	"time"
+
+	scdiscovery "github.com/go-chassis/cari/discovery"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStaleCache test serving the last known instances within the max age
+func TestStaleCache(t *testing.T) {
+	c := newStaleCache(time.Minute)
+	instances := []*scdiscovery.MicroServiceInstance{
+		{InstanceId: "1", Properties: map[string]string{"lane": "blue"}},
+	}
+	c.set(ServiceName, instances)
+	got, ok := c.get(ServiceName)
+	assert.True(t, ok)
+	assert.Equal(t, instances, got)
+
+	c.entries[ServiceName] = staleEntry{instances: instances, updated: time.Now().Add(-2 * time.Minute)}
+	_, ok = c.get(ServiceName)
+	assert.False(t, ok)
+
+	stale := markStale(instances)
+	assert.Equal(t, map[string]string{"lane": "blue", "kitex.stale": "true"}, stale[0].Properties)
+	assert.Equal(t, map[string]string{"lane": "blue"}, instances[0].Properties)
+}
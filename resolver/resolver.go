@@ -16,18 +16,44 @@ package resolver
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/klog"
 	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	scdiscovery "github.com/go-chassis/cari/discovery"
 	"github.com/go-chassis/sc-client"
 	"github.com/kitex-contrib/registry-servicecomb/servicecomb"
+	"github.com/thoas/go-funk"
 )
 
 type options struct {
-	appId       string
-	versionRule string
-	consumerId  string
+	appId              string
+	versionRule        string
+	consumerId         string
+	defaultWeight      int
+	maxWeight          int
+	network            string
+	schemes            []string
+	region             string
+	zone               string
+	minZoneInstances   int
+	minRegionInstances int
+	watch              bool
+	watchResync        time.Duration
+	staleMaxAge        time.Duration
+	snapshotDir        string
+	snapshotMaxAge     time.Duration
+	selector           Selector
+	serviceSelectors   map[string]Selector
+	statuses           []string
+	statusTag          bool
 }
 
 // Option is service-comb resolver option.
@@ -48,9 +74,116 @@ func WithConsumerId(consumerId string) Option {
 	return func(o *options) { o.consumerId = consumerId }
 }
 
+// WithNetwork with the address family of resolved endpoints, "tcp4" or "tcp6".
+// Endpoints of both families are returned by default.
+func WithNetwork(network string) Option {
+	return func(o *options) { o.network = network }
+}
+
+// WithSchemes with the endpoint schemes supported by the client, endpoints of
+// other schemes are skipped. Bare host:port endpoints are matched by "".
+func WithSchemes(schemes ...string) Option {
+	return func(o *options) { o.schemes = schemes }
+}
+
+// WithZoneAware prefers instances in the same availability zone, then in the
+// same region as the client, e.g. the values of servicecomb.SCDataCenter.
+func WithZoneAware(region, zone string) Option {
+	return func(o *options) {
+		o.region = region
+		o.zone = zone
+	}
+}
+
+// WithZoneAwareThresholds with the minimum instances in the same zone and in
+// the same region to use them only, both default to 1.
+func WithZoneAwareThresholds(minZoneInstances, minRegionInstances int) Option {
+	return func(o *options) {
+		o.minZoneInstances = minZoneInstances
+		o.minRegionInstances = minRegionInstances
+	}
+}
+
+// WithWatch serves Resolve from a local cache kept up to date by the instance
+// change events of ServiceComb, instead of querying it every time. It reduces
+// the queries to ServiceComb, but Kitex still sees the changes only when it
+// calls Resolve on its own refresh interval. Events are lost while the watch
+// reconnects, so the cache of a service is refreshed by a query at least
+// every resync, which defaults to one minute when it is not positive.
+// It requires WithConsumerId, the events are pushed for its providers.
+func WithWatch(resync time.Duration) Option {
+	return func(o *options) {
+		o.watch = true
+		o.watchResync = resync
+	}
+}
+
+// WithStaleCache serves the last known instances of a service, tagged with
+// servicecomb.PropertyStale, when ServiceComb can not be queried, as long as
+// they are not older than maxAge.
+func WithStaleCache(maxAge time.Duration) Option {
+	return func(o *options) { o.staleMaxAge = maxAge }
+}
+
+// WithSnapshot writes the instances of resolved services into dir when they
+// change, and serves them when ServiceComb can not be queried and nothing is cached in
+// memory, e.g. right after the process starts. Snapshots older than maxAge are
+// ignored, zero means no limit.
+func WithSnapshot(dir string, maxAge time.Duration) Option {
+	return func(o *options) {
+		o.snapshotDir = dir
+		o.snapshotMaxAge = maxAge
+	}
+}
+
+// WithSelector only returns the instances whose properties match selector,
+// e.g. the result of ParseSelector("lane=blue").
+func WithSelector(selector Selector) Option {
+	return func(o *options) { o.selector = selector }
+}
+
+// WithServiceSelector only returns the instances of serviceName whose
+// properties match selector, in addition to the one of WithSelector.
+func WithServiceSelector(serviceName string, selector Selector) Option {
+	return func(o *options) {
+		if o.serviceSelectors == nil {
+			o.serviceSelectors = make(map[string]Selector)
+		}
+		o.serviceSelectors[serviceName] = selector
+	}
+}
+
+// WithStatuses with the instance statuses returned by Resolve, e.g.
+// servicecomb.StatusTesting for test harnesses. Only UP instances are returned
+// by default.
+func WithStatuses(statuses ...string) Option {
+	return func(o *options) { o.statuses = statuses }
+}
+
+// WithStatusTag tags the resolved instances with their status under
+// servicecomb.PropertyStatus, so that a load balancer accepting several
+// statuses can tell them apart.
+func WithStatusTag() Option {
+	return func(o *options) { o.statusTag = true }
+}
+
+// WithDefaultWeight with the weight used for instances that do not publish a
+// valid one. It must be positive, and is bounded by WithMaxWeight.
+func WithDefaultWeight(weight int) Option {
+	return func(o *options) { o.defaultWeight = weight }
+}
+
+// WithMaxWeight with the upper bound of instance weights, zero means unbounded.
+func WithMaxWeight(weight int) Option {
+	return func(o *options) { o.maxWeight = weight }
+}
+
 type serviceCombResolver struct {
-	cli  *sc.Client
-	opts options
+	cli      *sc.Client
+	opts     options
+	watch    *watchCache
+	stale    *staleCache
+	snapshot *snapshotStore
 }
 
 func NewDefaultSCResolver(opts ...Option) (discovery.Resolver, error) {
@@ -63,43 +196,103 @@ func NewDefaultSCResolver(opts ...Option) (discovery.Resolver, error) {
 
 func NewSCResolver(cli *sc.Client, opts ...Option) discovery.Resolver {
 	op := options{
-		appId:       "DEFAULT",
-		versionRule: "latest",
-		consumerId:  "",
+		appId:              "DEFAULT",
+		versionRule:        "latest",
+		consumerId:         "",
+		defaultWeight:      discovery.DefaultWeight,
+		schemes:            []string{"", servicecomb.SchemeKitex},
+		statuses:           []string{servicecomb.StatusUp},
+		minZoneInstances:   1,
+		minRegionInstances: 1,
 	}
 	for _, option := range opts {
 		option(&op)
 	}
-	return &serviceCombResolver{
+	if op.defaultWeight <= 0 {
+		klog.Warnf("invalid default weight %d, use %d", op.defaultWeight, discovery.DefaultWeight)
+		op.defaultWeight = discovery.DefaultWeight
+	}
+	if op.maxWeight < 0 {
+		klog.Warnf("invalid max weight %d, weights are unbounded", op.maxWeight)
+		op.maxWeight = 0
+	}
+	if op.maxWeight > 0 && op.defaultWeight > op.maxWeight {
+		op.defaultWeight = op.maxWeight
+	}
+	for _, status := range op.statuses {
+		if !servicecomb.IsValidStatus(status) {
+			klog.Warnf("unknown instance status %q, no instance will match it", status)
+		}
+	}
+	scr := &serviceCombResolver{
 		cli:  cli,
 		opts: op,
 	}
+	if op.staleMaxAge > 0 {
+		scr.stale = newStaleCache(op.staleMaxAge)
+	}
+	if op.snapshotDir != "" {
+		scr.snapshot = newSnapshotStore(op.snapshotDir, op.snapshotMaxAge)
+	}
+	if op.watch {
+		if op.consumerId == "" {
+			klog.Warnf("watch is disabled because the consumer id is empty")
+		} else {
+			resync := op.watchResync
+			if resync <= 0 {
+				resync = defaultWatchResync
+			}
+			scr.watch = newWatchCache(resync)
+		}
+	}
+	return scr
 }
 
 // Target return a description for the given target that is suitable for being a key for cache.
+// The app_id, version_rule and environment tags of target override the
+// resolver options for this target, they are encoded into the description as
+// a query string, e.g. "hello?app_id=demo&version_rule=1.0.0".
 func (scr *serviceCombResolver) Target(_ context.Context, target rpcinfo.EndpointInfo) (description string) {
-	return target.ServiceName()
+	params := url.Values{}
+	for _, key := range []string{servicecomb.TagAppId, servicecomb.TagVersionRule, servicecomb.TagEnvironment} {
+		if value, ok := target.Tag(key); ok && value != "" {
+			params.Set(key, value)
+		}
+	}
+	if len(params) == 0 {
+		return target.ServiceName()
+	}
+	return target.ServiceName() + "?" + params.Encode()
 }
 
 // Resolve a service info by desc.
 func (scr *serviceCombResolver) Resolve(_ context.Context, desc string) (discovery.Result, error) {
-	res, err := scr.cli.FindMicroServiceInstances(scr.opts.consumerId, scr.opts.appId, desc, scr.opts.versionRule, sc.WithoutRevision())
+	q, err := scr.queryOf(desc)
 	if err != nil {
 		return discovery.Result{}, err
 	}
-	instances := make([]discovery.Instance, 0, len(res))
-	for _, in := range res {
-		if in.Status != sc.MSInstanceUP {
-			continue
+	res, err := scr.findInstances(desc, q)
+	if err != nil {
+		if errors.Is(err, sc.ErrMicroServiceNotExists) {
+			return discovery.Result{}, err
 		}
-		for _, endPoint := range in.Endpoints {
-			instances = append(instances, discovery.NewInstance(
-				"tcp",
-				endPoint,
-				10,
-				in.Properties))
+		cached, ok := scr.lastKnown(desc, q)
+		if !ok {
+			return discovery.Result{}, err
+		}
+		klog.Warnf("resolve %s error:%v, use the last known instances", desc, err)
+		res = markStale(cached)
+	} else {
+		if scr.stale != nil {
+			scr.stale.set(desc, res)
+		}
+		if scr.snapshot != nil {
+			if err := scr.snapshot.save(q, res); err != nil {
+				klog.Warnf("save snapshot of %s error:%v", desc, err)
+			}
 		}
 	}
+	instances := flatten(scr.preferLocal(scr.buildInstances(q, res)))
 	if len(instances) == 0 {
 		return discovery.Result{}, fmt.Errorf("no instance remains for %v", desc)
 	}
@@ -110,6 +303,241 @@ func (scr *serviceCombResolver) Resolve(_ context.Context, desc string) (discove
 	}, nil
 }
 
+// query selects the ServiceComb instances of a service.
+type query struct {
+	appId       string
+	serviceName string
+	versionRule string
+	environment string
+}
+
+// queryOf decodes desc returned by Target, falling back to the resolver
+// options for the missing tags.
+func (scr *serviceCombResolver) queryOf(desc string) (query, error) {
+	q := query{appId: scr.opts.appId, serviceName: desc, versionRule: scr.opts.versionRule}
+	i := strings.IndexByte(desc, '?')
+	if i < 0 {
+		return q, nil
+	}
+	params, err := url.ParseQuery(desc[i+1:])
+	if err != nil {
+		return q, fmt.Errorf("parse target %s error: %w", desc, err)
+	}
+	q.serviceName = desc[:i]
+	if appId := params.Get(servicecomb.TagAppId); appId != "" {
+		q.appId = appId
+	}
+	if versionRule := params.Get(servicecomb.TagVersionRule); versionRule != "" {
+		q.versionRule = versionRule
+	}
+	q.environment = params.Get(servicecomb.TagEnvironment)
+	return q, nil
+}
+
+// findInstances queries the instances of desc, or takes them from the watch cache.
+func (scr *serviceCombResolver) findInstances(desc string, q query) ([]*scdiscovery.MicroServiceInstance, error) {
+	if scr.watch != nil {
+		if res, ok := scr.watch.get(desc); ok {
+			return res, nil
+		}
+	}
+	res, err := scr.queryInstances(q)
+	if err != nil {
+		return nil, err
+	}
+	if scr.watch != nil {
+		scr.watch.set(desc, q, res)
+		scr.ensureWatch()
+	}
+	return res, nil
+}
+
+// queryInstances queries the instances of q from ServiceComb. The instance
+// query only searches the environment of the consumer, so the provider of
+// another environment is looked up first, which picks a single service
+// version matching the rule.
+func (scr *serviceCombResolver) queryInstances(q query) ([]*scdiscovery.MicroServiceInstance, error) {
+	if q.environment == "" {
+		return scr.cli.FindMicroServiceInstances(scr.opts.consumerId, q.appId, q.serviceName, q.versionRule, sc.WithoutRevision())
+	}
+	serviceId, err := scr.cli.GetMicroServiceID(q.appId, q.serviceName, q.versionRule, q.environment)
+	if err != nil {
+		return nil, err
+	}
+	if serviceId == "" {
+		return nil, sc.ErrMicroServiceNotExists
+	}
+	return scr.cli.GetMicroServiceInstances(scr.opts.consumerId, serviceId)
+}
+
+// lastKnown returns the last known instances of desc from the stale cache, or
+// from the snapshot on disk after a cold start.
+func (scr *serviceCombResolver) lastKnown(desc string, q query) ([]*scdiscovery.MicroServiceInstance, bool) {
+	if scr.stale != nil {
+		if res, ok := scr.stale.get(desc); ok {
+			return res, true
+		}
+	}
+	if scr.snapshot != nil {
+		res, err := scr.snapshot.load(q)
+		if err == nil {
+			return res, true
+		}
+		klog.Warnf("load snapshot of %s error:%v", desc, err)
+	}
+	return nil, false
+}
+
+// buildInstances converts the ServiceComb instances of accepted statuses
+// matching the selectors of q into kitex instances, one per supported endpoint.
+// The kitex instances are grouped by ServiceComb instance, instances without
+// a supported endpoint are dropped.
+func (scr *serviceCombResolver) buildInstances(q query, res []*scdiscovery.MicroServiceInstance) [][]discovery.Instance {
+	groups := make([][]discovery.Instance, 0, len(res))
+	for _, in := range res {
+		if !funk.ContainsString(scr.opts.statuses, in.Status) || !scr.selects(q, in.Properties) {
+			continue
+		}
+		weight := scr.instanceWeight(in.Properties)
+		tags := instanceTags(in)
+		if scr.opts.statusTag {
+			tags = withTag(tags, servicecomb.PropertyStatus, in.Status)
+		}
+		var instances []discovery.Instance
+		for _, ep := range in.Endpoints {
+			scheme, endPoint, _, err := servicecomb.ParseEndpoint(ep)
+			if err != nil || !funk.ContainsString(scr.opts.schemes, scheme) || !scr.matchNetwork(endPoint) {
+				continue
+			}
+			instances = append(instances, discovery.NewInstance(
+				"tcp",
+				endPoint,
+				weight,
+				tags))
+		}
+		if len(instances) > 0 {
+			groups = append(groups, instances)
+		}
+	}
+	return groups
+}
+
+// flatten returns the kitex instances of all groups.
+func flatten(groups [][]discovery.Instance) []discovery.Instance {
+	var instances []discovery.Instance
+	for _, group := range groups {
+		instances = append(instances, group...)
+	}
+	return instances
+}
+
+// selects reports whether properties match the global selector and the one
+// of the service of q.
+func (scr *serviceCombResolver) selects(q query, properties map[string]string) bool {
+	if !scr.opts.selector.Matches(properties) {
+		return false
+	}
+	selector, ok := scr.opts.serviceSelectors[q.serviceName]
+	return !ok || selector.Matches(properties)
+}
+
+// preferLocal returns the ServiceComb instances in the same zone when there
+// are enough of them, then the ones in the same region, and all instances at
+// last. Each group of buildInstances counts as one instance, whatever its
+// number of endpoints.
+func (scr *serviceCombResolver) preferLocal(groups [][]discovery.Instance) [][]discovery.Instance {
+	if scr.opts.zone == "" && scr.opts.region == "" {
+		return groups
+	}
+	var sameZone, sameRegion [][]discovery.Instance
+	for _, group := range groups {
+		region, _ := group[0].Tag(servicecomb.PropertyRegion)
+		zone, _ := group[0].Tag(servicecomb.PropertyZone)
+		if scr.opts.region != "" && region != scr.opts.region {
+			continue
+		}
+		sameRegion = append(sameRegion, group)
+		if scr.opts.zone != "" && zone == scr.opts.zone {
+			sameZone = append(sameZone, group)
+		}
+	}
+	if scr.opts.zone != "" && len(sameZone) > 0 && len(sameZone) >= scr.opts.minZoneInstances {
+		return sameZone
+	}
+	if scr.opts.region != "" && len(sameRegion) > 0 && len(sameRegion) >= scr.opts.minRegionInstances {
+		return sameRegion
+	}
+	return groups
+}
+
+// instanceTags returns the properties of in, with its datacenter info added.
+func instanceTags(in *scdiscovery.MicroServiceInstance) map[string]string {
+	dc := in.DataCenterInfo
+	if dc == nil {
+		return in.Properties
+	}
+	tags := make(map[string]string, len(in.Properties)+3)
+	for k, v := range in.Properties {
+		tags[k] = v
+	}
+	if dc.Name != "" {
+		tags[servicecomb.PropertyDataCenter] = dc.Name
+	}
+	if dc.Region != "" {
+		tags[servicecomb.PropertyRegion] = dc.Region
+	}
+	if dc.AvailableZone != "" {
+		tags[servicecomb.PropertyZone] = dc.AvailableZone
+	}
+	return tags
+}
+
+// withTag returns a copy of tags with key set to value.
+func withTag(tags map[string]string, key, value string) map[string]string {
+	res := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		res[k] = v
+	}
+	res[key] = value
+	return res
+}
+
+// matchNetwork reports whether endpoint belongs to the configured address family.
+func (scr *serviceCombResolver) matchNetwork(endpoint string) bool {
+	if scr.opts.network == "" || scr.opts.network == "tcp" {
+		return true
+	}
+	host, _, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		// host names are resolved later by the dialer
+		return true
+	}
+	isIPv4 := ip.To4() != nil
+	return isIPv4 == (scr.opts.network == "tcp4")
+}
+
+// instanceWeight reads the weight published by the registry, falling back to
+// the default weight when it is missing or invalid.
+func (scr *serviceCombResolver) instanceWeight(properties map[string]string) int {
+	text, ok := properties[servicecomb.PropertyWeight]
+	if !ok {
+		return scr.opts.defaultWeight
+	}
+	weight, err := strconv.Atoi(text)
+	if err != nil || weight <= 0 {
+		klog.Warnf("invalid instance weight %q, use default weight %d", text, scr.opts.defaultWeight)
+		return scr.opts.defaultWeight
+	}
+	if scr.opts.maxWeight > 0 && weight > scr.opts.maxWeight {
+		return scr.opts.maxWeight
+	}
+	return weight
+}
+
 // Diff computes the difference between two results.
 func (scr *serviceCombResolver) Diff(cacheKey string, prev, next discovery.Result) (discovery.Change, bool) {
 	return discovery.DefaultDiff(cacheKey, prev, next)
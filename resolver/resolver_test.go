@@ -23,6 +23,8 @@ import (
 
 	"github.com/cloudwego/kitex/pkg/discovery"
 	"github.com/cloudwego/kitex/pkg/registry"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	scdiscovery "github.com/go-chassis/cari/discovery"
 	"github.com/go-chassis/sc-client"
 	scregistry "github.com/kitex-contrib/registry-servicecomb/registry"
 	"github.com/stretchr/testify/assert"
@@ -41,7 +43,7 @@ var (
 		Addr:        &ServiceAddr,
 		Tags: map[string]string{
 			"app_id":  AppId,
-			"version": LatestVersion,
+			"version": Version,
 		},
 	}
 )
@@ -135,3 +137,183 @@ func TestSCResolverResolve(t *testing.T) {
 		return
 	}
 }
+
+// TestSCResolverInstanceWeight test reading the weight published by the registry
+func TestSCResolverInstanceWeight(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []Option
+		properties map[string]string
+		want       int
+	}{
+		{
+			name: "missing",
+			want: discovery.DefaultWeight,
+		},
+		{
+			name:       "common",
+			properties: map[string]string{"kitex.weight": "20"},
+			want:       20,
+		},
+		{
+			name:       "invalid",
+			opts:       []Option{WithDefaultWeight(5)},
+			properties: map[string]string{"kitex.weight": "abc"},
+			want:       5,
+		},
+		{
+			name:       "not positive",
+			properties: map[string]string{"kitex.weight": "0"},
+			want:       discovery.DefaultWeight,
+		},
+		{
+			name:       "over max",
+			opts:       []Option{WithMaxWeight(50)},
+			properties: map[string]string{"kitex.weight": "100"},
+			want:       50,
+		},
+		{
+			name: "invalid default",
+			opts: []Option{WithDefaultWeight(0)},
+			want: discovery.DefaultWeight,
+		},
+		{
+			name: "negative default",
+			opts: []Option{WithDefaultWeight(-1)},
+			want: discovery.DefaultWeight,
+		},
+		{
+			name: "default over max",
+			opts: []Option{WithDefaultWeight(100), WithMaxWeight(50)},
+			want: 50,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := NewSCResolver(SCClient, tt.opts...).(*serviceCombResolver)
+			assert.Equal(t, tt.want, n.instanceWeight(tt.properties))
+		})
+	}
+}
+
+// TestSCResolverMatchNetwork test filtering endpoints by address family
+func TestSCResolverMatchNetwork(t *testing.T) {
+	all := NewSCResolver(SCClient).(*serviceCombResolver)
+	v4 := NewSCResolver(SCClient, WithNetwork("tcp4")).(*serviceCombResolver)
+	v6 := NewSCResolver(SCClient, WithNetwork("tcp6")).(*serviceCombResolver)
+	assert.True(t, all.matchNetwork("[::1]:8080"))
+	assert.True(t, v4.matchNetwork("127.0.0.1:8080"))
+	assert.False(t, v4.matchNetwork("[::1]:8080"))
+	assert.True(t, v6.matchNetwork("[2001:db8::1]:8080"))
+	assert.False(t, v6.matchNetwork("127.0.0.1:8080"))
+}
+
+// TestInstanceTags test datacenter info is exposed as tags
+func TestInstanceTags(t *testing.T) {
+	in := &scdiscovery.MicroServiceInstance{
+		Properties:     map[string]string{"lane": "blue"},
+		DataCenterInfo: &scdiscovery.DataCenterInfo{Name: "dc1", Region: "cn-north", AvailableZone: "az1"},
+	}
+	assert.Equal(t, map[string]string{
+		"lane":             "blue",
+		"kitex.datacenter": "dc1",
+		"kitex.region":     "cn-north",
+		"kitex.zone":       "az1",
+	}, instanceTags(in))
+	assert.Equal(t, map[string]string{"lane": "blue"}, in.Properties)
+}
+
+// TestSCResolverPreferLocal test preferring instances in the same zone and region
+func TestSCResolverPreferLocal(t *testing.T) {
+	newInstance := func(region, zone string, addrs ...string) []discovery.Instance {
+		var group []discovery.Instance
+		for _, addr := range addrs {
+			group = append(group, discovery.NewInstance("tcp", addr, 10, map[string]string{"kitex.region": region, "kitex.zone": zone}))
+		}
+		return group
+	}
+	a1 := newInstance("r1", "a1", "10.0.0.1:8080", "10.0.0.1:8081")
+	a2 := newInstance("r1", "a2", "10.0.0.2:8080")
+	b1 := newInstance("r2", "b1", "10.0.1.1:8080")
+	all := [][]discovery.Instance{a1, a2, b1}
+
+	n := NewSCResolver(SCClient).(*serviceCombResolver)
+	assert.Equal(t, all, n.preferLocal(all))
+
+	n = NewSCResolver(SCClient, WithZoneAware("r1", "a1")).(*serviceCombResolver)
+	assert.Equal(t, [][]discovery.Instance{a1}, n.preferLocal(all))
+
+	// the two endpoints of a1 count as a single instance
+	n = NewSCResolver(SCClient, WithZoneAware("r1", "a1"), WithZoneAwareThresholds(2, 2)).(*serviceCombResolver)
+	assert.Equal(t, [][]discovery.Instance{a1, a2}, n.preferLocal(all))
+
+	n = NewSCResolver(SCClient, WithZoneAware("r1", "a1"), WithZoneAwareThresholds(2, 3)).(*serviceCombResolver)
+	assert.Equal(t, all, n.preferLocal(all))
+
+	n = NewSCResolver(SCClient, WithZoneAware("r3", "c1"), WithZoneAwareThresholds(0, 0)).(*serviceCombResolver)
+	assert.Equal(t, all, n.preferLocal(all))
+
+	assert.Len(t, flatten(all), 4)
+}
+
+// TestSCResolverStatuses test filtering and tagging instances by status
+func TestSCResolverStatuses(t *testing.T) {
+	res := []*scdiscovery.MicroServiceInstance{
+		{Status: "UP", Endpoints: []string{"127.0.0.1:8080"}},
+		{Status: "TESTING", Endpoints: []string{"127.0.0.1:8081"}},
+		{Status: "DOWN", Endpoints: []string{"127.0.0.1:8082"}},
+	}
+	q := query{serviceName: ServiceName}
+
+	n := NewSCResolver(SCClient).(*serviceCombResolver)
+	instances := flatten(n.buildInstances(q, res))
+	assert.Len(t, instances, 1)
+	_, ok := instances[0].Tag("kitex.status")
+	assert.False(t, ok)
+
+	n = NewSCResolver(SCClient, WithStatuses("UP", "TESTING"), WithStatusTag()).(*serviceCombResolver)
+	instances = flatten(n.buildInstances(q, res))
+	assert.Len(t, instances, 2)
+	status, _ := instances[1].Tag("kitex.status")
+	assert.Equal(t, "TESTING", status)
+}
+
+// TestSCResolverTarget test encoding the target tags into the description and decoding them
+func TestSCResolverTarget(t *testing.T) {
+	n := NewSCResolver(SCClient, WithAppId("app"), WithVersionRule("latest")).(*serviceCombResolver)
+	tests := []struct {
+		name string
+		tags map[string]string
+		desc string
+		want query
+	}{
+		{
+			name: "no tags",
+			desc: ServiceName,
+			want: query{appId: "app", serviceName: ServiceName, versionRule: "latest"},
+		},
+		{
+			name: "version rule",
+			tags: map[string]string{"version_rule": "1.0.0+", "lane": "blue"},
+			desc: ServiceName + "?version_rule=1.0.0%2B",
+			want: query{appId: "app", serviceName: ServiceName, versionRule: "1.0.0+"},
+		},
+		{
+			name: "all tags",
+			tags: map[string]string{"app_id": "other", "version_rule": "1.0.0", "environment": "testing"},
+			desc: ServiceName + "?app_id=other&environment=testing&version_rule=1.0.0",
+			want: query{appId: "other", serviceName: ServiceName, versionRule: "1.0.0", environment: "testing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desc := n.Target(context.Background(), rpcinfo.NewEndpointInfo(ServiceName, "", nil, tt.tags))
+			assert.Equal(t, tt.desc, desc)
+			q, err := n.queryOf(desc)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, q)
+		})
+	}
+	_, err := n.queryOf(ServiceName + "?app_id=%zz")
+	assert.NotNil(t, err)
+}
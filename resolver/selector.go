@@ -0,0 +1,194 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/thoas/go-funk"
+)
+
+type operator int
+
+const (
+	opEquals operator = iota
+	opNotEquals
+	opIn
+	opNotIn
+	opExists
+	opNotExists
+)
+
+type requirement struct {
+	key    string
+	op     operator
+	values []string
+}
+
+// matches reports whether properties satisfy the requirement.
+func (r requirement) matches(properties map[string]string) bool {
+	value, ok := properties[r.key]
+	switch r.op {
+	case opEquals:
+		return ok && value == r.values[0]
+	case opNotEquals:
+		return !ok || value != r.values[0]
+	case opIn:
+		return ok && funk.ContainsString(r.values, value)
+	case opNotIn:
+		return !ok || !funk.ContainsString(r.values, value)
+	case opExists:
+		return ok
+	default:
+		return !ok
+	}
+}
+
+// Selector filters instances by their properties. All its requirements must
+// be satisfied, an empty Selector matches every instance.
+type Selector struct {
+	requirements []requirement
+}
+
+// Matches reports whether properties satisfy the selector.
+func (s Selector) Matches(properties map[string]string) bool {
+	for _, r := range s.requirements {
+		if !r.matches(properties) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseSelector parses a comma separated list of requirements, each of which
+// is one of:
+//
+//	key=value, key==value   the property equals value
+//	key!=value              the property is missing or differs from value
+//	key in (v1,v2)          the property is one of the values
+//	key notin (v1,v2)       the property is missing or none of the values
+//	key                     the property exists
+//	!key                    the property does not exist
+//
+// e.g. "lane=blue,version in (1.0,1.1),!canary".
+func ParseSelector(selector string) (Selector, error) {
+	var s Selector
+	parts, err := splitRequirements(selector)
+	if err != nil {
+		return s, err
+	}
+	for _, part := range parts {
+		r, err := parseRequirement(part)
+		if err != nil {
+			return Selector{}, err
+		}
+		s.requirements = append(s.requirements, r)
+	}
+	return s, nil
+}
+
+// splitRequirements splits selector by the commas outside of parentheses.
+func splitRequirements(selector string) ([]string, error) {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range selector {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("invalid selector %q: unbalanced parentheses", selector)
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("invalid selector %q: unbalanced parentheses", selector)
+	}
+	parts = append(parts, selector[start:])
+	if len(parts) == 1 && strings.TrimSpace(parts[0]) == "" {
+		return nil, nil
+	}
+	return parts, nil
+}
+
+func parseRequirement(text string) (requirement, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return requirement{}, fmt.Errorf("invalid selector: empty requirement")
+	}
+	if strings.HasPrefix(text, "!") && !strings.Contains(text, "=") {
+		return newRequirement(text, text[1:], opNotExists, nil)
+	}
+	if i := strings.Index(text, "!="); i >= 0 {
+		return newRequirement(text, text[:i], opNotEquals, []string{strings.TrimSpace(text[i+2:])})
+	}
+	if i := strings.Index(text, "=="); i >= 0 {
+		return newRequirement(text, text[:i], opEquals, []string{strings.TrimSpace(text[i+2:])})
+	}
+	if i := strings.Index(text, "="); i >= 0 {
+		return newRequirement(text, text[:i], opEquals, []string{strings.TrimSpace(text[i+1:])})
+	}
+	if fields := strings.Fields(text); len(fields) > 1 {
+		key := fields[0]
+		rest := strings.TrimSpace(text[len(key):])
+		var op operator
+		switch {
+		case strings.HasPrefix(rest, "notin"):
+			op, rest = opNotIn, rest[len("notin"):]
+		case strings.HasPrefix(rest, "in"):
+			op, rest = opIn, rest[len("in"):]
+		default:
+			return requirement{}, fmt.Errorf("invalid selector requirement %q: unknown operator", text)
+		}
+		values, err := parseValues(text, strings.TrimSpace(rest))
+		if err != nil {
+			return requirement{}, err
+		}
+		return newRequirement(text, key, op, values)
+	}
+	return newRequirement(text, text, opExists, nil)
+}
+
+func newRequirement(text, key string, op operator, values []string) (requirement, error) {
+	key = strings.TrimSpace(key)
+	if key == "" || strings.ContainsAny(key, " ()!=") {
+		return requirement{}, fmt.Errorf("invalid selector requirement %q: bad key", text)
+	}
+	return requirement{key: key, op: op, values: values}, nil
+}
+
+// parseValues parses a parenthesized, comma separated list of values.
+func parseValues(text, list string) ([]string, error) {
+	if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+		return nil, fmt.Errorf("invalid selector requirement %q: values must be in parentheses", text)
+	}
+	var values []string
+	for _, v := range strings.Split(list[1:len(list)-1], ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("invalid selector requirement %q: empty values", text)
+	}
+	return values, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"testing"
+
+	scdiscovery "github.com/go-chassis/cari/discovery"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseSelector test parsing and matching selectors
+func TestParseSelector(t *testing.T) {
+	properties := map[string]string{"lane": "blue", "version": "1.1"}
+	tests := []struct {
+		selector string
+		want     bool
+		wantErr  bool
+	}{
+		{selector: "", want: true},
+		{selector: "lane=blue", want: true},
+		{selector: "lane==green", want: false},
+		{selector: "lane!=green", want: true},
+		{selector: "zone!=a", want: true},
+		{selector: "version in (1.0, 1.1)", want: true},
+		{selector: "version notin (1.0,1.1)", want: false},
+		{selector: "zone notin (a)", want: true},
+		{selector: "lane", want: true},
+		{selector: "!canary", want: true},
+		{selector: "!lane", want: false},
+		{selector: "lane=blue, version in (1.0,1.1), !canary", want: true},
+		{selector: "lane=blue,canary", want: false},
+		{selector: "lane=blue,", wantErr: true},
+		{selector: "version in (1.0", wantErr: true},
+		{selector: "version in ()", wantErr: true},
+		{selector: "version like (1.0)", wantErr: true},
+		{selector: "=blue", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			s, err := ParseSelector(tt.selector)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, s.Matches(properties))
+		})
+	}
+}
+
+// TestSCResolverSelects test filtering instances by global and per service selectors
+func TestSCResolverSelects(t *testing.T) {
+	blue, _ := ParseSelector("lane=blue")
+	canary, _ := ParseSelector("canary")
+	r := NewSCResolver(nil, WithSelector(blue), WithServiceSelector(ServiceName, canary)).(*serviceCombResolver)
+	res := []*scdiscovery.MicroServiceInstance{
+		{Status: "UP", Endpoints: []string{"127.0.0.1:8080"}, Properties: map[string]string{"lane": "blue", "canary": "true"}},
+		{Status: "UP", Endpoints: []string{"127.0.0.1:8081"}, Properties: map[string]string{"lane": "blue"}},
+		{Status: "UP", Endpoints: []string{"127.0.0.1:8082"}, Properties: map[string]string{"lane": "green"}},
+	}
+	instances := flatten(r.buildInstances(query{serviceName: ServiceName}, res))
+	assert.Len(t, instances, 1)
+	assert.Equal(t, "127.0.0.1:8080", instances[0].Address().String())
+	assert.Len(t, flatten(r.buildInstances(query{serviceName: "other"}, res)), 2)
+}
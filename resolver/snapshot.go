@@ -0,0 +1,138 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	scdiscovery "github.com/go-chassis/cari/discovery"
+)
+
+// snapshotStore persists the resolved instances of every query as a JSON file.
+// A snapshot is only rewritten when its instances change, or when it gets
+// close to maxAge, so that resolving unchanged services does not write to disk.
+type snapshotStore struct {
+	dir     string
+	maxAge  time.Duration
+	lock    sync.Mutex
+	written map[string]snapshotWrite
+}
+
+type snapshotWrite struct {
+	digest [sha256.Size]byte
+	at     time.Time
+}
+
+type snapshot struct {
+	AppId       string                              `json:"appId"`
+	ServiceName string                              `json:"serviceName"`
+	VersionRule string                              `json:"versionRule"`
+	Environment string                              `json:"environment,omitempty"`
+	Updated     time.Time                           `json:"updated"`
+	Instances   []*scdiscovery.MicroServiceInstance `json:"instances"`
+}
+
+func newSnapshotStore(dir string, maxAge time.Duration) *snapshotStore {
+	return &snapshotStore{dir: dir, maxAge: maxAge, written: make(map[string]snapshotWrite)}
+}
+
+// path returns the file of q, named by the hash of q so that distinct queries
+// never share a file.
+func (s *snapshotStore) path(q query) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{q.appId, q.serviceName, q.versionRule, q.environment}, "\x00")))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// save writes the instances of q, replacing the previous snapshot atomically.
+func (s *snapshotStore) save(q query, instances []*scdiscovery.MicroServiceInstance) error {
+	sorted := make([]*scdiscovery.MicroServiceInstance, len(instances))
+	copy(sorted, instances)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].InstanceId < sorted[j].InstanceId })
+	content, err := json.Marshal(sorted)
+	if err != nil {
+		return err
+	}
+	path := s.path(q)
+	digest := sha256.Sum256(content)
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if last, ok := s.written[path]; ok && last.digest == digest && (s.maxAge <= 0 || now.Sub(last.at) < s.maxAge/2) {
+		return nil
+	}
+
+	data, err := json.Marshal(&snapshot{
+		AppId:       q.appId,
+		ServiceName: q.serviceName,
+		VersionRule: q.versionRule,
+		Environment: q.environment,
+		Updated:     now,
+		Instances:   sorted,
+	})
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.dir, ".snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	s.written[path] = snapshotWrite{digest: digest, at: now}
+	return nil
+}
+
+// load reads the instances of q, failing if the snapshot is older than maxAge.
+func (s *snapshotStore) load(q query) ([]*scdiscovery.MicroServiceInstance, error) {
+	data, err := ioutil.ReadFile(s.path(q))
+	if err != nil {
+		return nil, err
+	}
+	var snap snapshot
+	if err = json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	if snap.AppId != q.appId || snap.ServiceName != q.serviceName || snap.VersionRule != q.versionRule ||
+		snap.Environment != q.environment {
+		return nil, fmt.Errorf("snapshot of %s/%s/%s/%s does not match the query", snap.AppId, snap.ServiceName,
+			snap.VersionRule, snap.Environment)
+	}
+	if s.maxAge > 0 && time.Since(snap.Updated) > s.maxAge {
+		return nil, fmt.Errorf("snapshot updated at %v is too old", snap.Updated)
+	}
+	return snap.Instances, nil
+}
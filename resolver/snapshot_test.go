@@ -0,0 +1,84 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	scdiscovery "github.com/go-chassis/cari/discovery"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSnapshotStore test saving and loading snapshots
+func TestSnapshotStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sc-snapshot")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	q := query{appId: AppId, serviceName: ServiceName, versionRule: LatestVersion}
+	instances := []*scdiscovery.MicroServiceInstance{
+		{InstanceId: "1", Endpoints: []string{"127.0.0.1:8080"}, Status: "UP"},
+	}
+	s := newSnapshotStore(dir, time.Minute)
+	_, err = s.load(q)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, s.save(q, instances))
+	got, err := s.load(q)
+	assert.Nil(t, err)
+	assert.Equal(t, instances, got)
+
+	_, err = newSnapshotStore(dir, time.Nanosecond).load(q)
+	assert.NotNil(t, err)
+
+	// queries whose fields only differ by separators do not share a file
+	q1 := query{appId: "a_b", serviceName: "c", versionRule: LatestVersion}
+	q2 := query{appId: "a", serviceName: "b_c", versionRule: LatestVersion}
+	assert.NotEqual(t, s.path(q1), s.path(q2))
+	assert.Nil(t, s.save(q1, instances))
+	_, err = s.load(q2)
+	assert.NotNil(t, err)
+
+	// a snapshot of another query is refused
+	assert.Nil(t, os.Rename(s.path(q1), s.path(q2)))
+	_, err = s.load(q2)
+	assert.NotNil(t, err)
+}
+
+// TestSnapshotStoreUnchanged test unchanged instances are not written again
+func TestSnapshotStoreUnchanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sc-snapshot")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	q := query{appId: AppId, serviceName: ServiceName, versionRule: LatestVersion}
+	i1 := &scdiscovery.MicroServiceInstance{InstanceId: "1", Status: "UP"}
+	i2 := &scdiscovery.MicroServiceInstance{InstanceId: "2", Status: "UP"}
+	s := newSnapshotStore(dir, time.Hour)
+	assert.Nil(t, s.save(q, []*scdiscovery.MicroServiceInstance{i1, i2}))
+	assert.Nil(t, os.Remove(s.path(q)))
+
+	assert.Nil(t, s.save(q, []*scdiscovery.MicroServiceInstance{i2, i1}))
+	_, err = os.Stat(s.path(q))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, s.save(q, []*scdiscovery.MicroServiceInstance{i1}))
+	got, err := s.load(q)
+	assert.Nil(t, err)
+	assert.Equal(t, []*scdiscovery.MicroServiceInstance{i1}, got)
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/klog"
+	scdiscovery "github.com/go-chassis/cari/discovery"
+	"github.com/go-chassis/sc-client"
+)
+
+// defaultWatchResync bounds how long the cache may miss the events dropped
+// while the watch reconnects.
+const defaultWatchResync = time.Minute
+
+// watchCache keeps the instances of resolved services up to date with the
+// instance change events pushed by ServiceComb.
+type watchCache struct {
+	lock     sync.Mutex
+	resync   time.Duration
+	watching bool
+	entries  map[string]*watchEntry
+}
+
+type watchEntry struct {
+	query
+	instances map[string]*scdiscovery.MicroServiceInstance
+	updated   time.Time
+	// dirty is set when an event can not be applied to the entry, so that
+	// the next Resolve queries ServiceComb again
+	dirty bool
+}
+
+func newWatchCache(resync time.Duration) *watchCache {
+	return &watchCache{
+		resync:  resync,
+		entries: make(map[string]*watchEntry),
+	}
+}
+
+// get returns the cached instances of desc if they are usable.
+func (wc *watchCache) get(desc string) ([]*scdiscovery.MicroServiceInstance, bool) {
+	wc.lock.Lock()
+	defer wc.lock.Unlock()
+	entry, ok := wc.entries[desc]
+	if !ok || !wc.watching || entry.dirty || time.Since(entry.updated) > wc.resync {
+		return nil, false
+	}
+	res := make([]*scdiscovery.MicroServiceInstance, 0, len(entry.instances))
+	for _, in := range entry.instances {
+		res = append(res, in)
+	}
+	return res, true
+}
+
+// set replaces the cached instances of desc with a query result.
+func (wc *watchCache) set(desc string, q query, res []*scdiscovery.MicroServiceInstance) {
+	instances := make(map[string]*scdiscovery.MicroServiceInstance, len(res))
+	for _, in := range res {
+		instances[in.InstanceId] = in
+	}
+	wc.lock.Lock()
+	defer wc.lock.Unlock()
+	wc.entries[desc] = &watchEntry{
+		query:     q,
+		instances: instances,
+		updated:   time.Now(),
+	}
+}
+
+// onEvent applies an instance change event to the matching entries.
+func (wc *watchCache) onEvent(event *sc.MicroServiceInstanceChangedEvent) {
+	if event == nil || event.Key == nil || event.Instance == nil {
+		return
+	}
+	wc.lock.Lock()
+	defer wc.lock.Unlock()
+	for _, entry := range wc.entries {
+		if entry.appId != event.Key.AppId || entry.serviceName != event.Key.ServiceName ||
+			(entry.environment != "" && entry.environment != event.Key.Environment) {
+			continue
+		}
+		_, known := entry.instances[event.Instance.InstanceId]
+		switch {
+		case event.Action == sc.EventDelete:
+			delete(entry.instances, event.Instance.InstanceId)
+		case known || entry.versionRule == event.Key.Version:
+			entry.instances[event.Instance.InstanceId] = event.Instance
+		default:
+			// whether a new instance matches a version rule is decided by ServiceComb
+			entry.dirty = true
+		}
+	}
+}
+
+// ensureWatch subscribes to the instance changes of the providers of the
+// consumer, once. ServiceComb client resubscribes by itself on disconnect.
+func (scr *serviceCombResolver) ensureWatch() {
+	wc := scr.watch
+	wc.lock.Lock()
+	if wc.watching {
+		wc.lock.Unlock()
+		return
+	}
+	wc.watching = true
+	wc.lock.Unlock()
+
+	if err := scr.cli.WatchMicroService(scr.opts.consumerId, wc.onEvent); err != nil {
+		klog.Warnf("watch instances of consumer %s error:%v, retry on next resolve", scr.opts.consumerId, err)
+		wc.lock.Lock()
+		wc.watching = false
+		wc.lock.Unlock()
+	}
+}
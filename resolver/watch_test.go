@@ -0,0 +1,72 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"testing"
+	"time"
+
+	scdiscovery "github.com/go-chassis/cari/discovery"
+	"github.com/go-chassis/sc-client"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWatchCache test applying instance change events to the cache
+func TestWatchCache(t *testing.T) {
+	wc := newWatchCache(time.Minute)
+	wc.watching = true
+	wc.set(ServiceName, query{appId: AppId, serviceName: ServiceName, versionRule: Version}, []*scdiscovery.MicroServiceInstance{
+		{InstanceId: "1", Status: sc.MSInstanceUP},
+	})
+	key := &scdiscovery.MicroServiceKey{AppId: AppId, ServiceName: ServiceName, Version: Version}
+
+	wc.onEvent(&sc.MicroServiceInstanceChangedEvent{
+		Action:   sc.EventCreate,
+		Key:      key,
+		Instance: &scdiscovery.MicroServiceInstance{InstanceId: "2", Status: sc.MSInstanceUP},
+	})
+	wc.onEvent(&sc.MicroServiceInstanceChangedEvent{
+		Action:   sc.EventDelete,
+		Key:      key,
+		Instance: &scdiscovery.MicroServiceInstance{InstanceId: "1"},
+	})
+	res, ok := wc.get(ServiceName)
+	assert.True(t, ok)
+	assert.Len(t, res, 1)
+	assert.Equal(t, "2", res[0].InstanceId)
+
+	// events may have been lost, the cache is refreshed after resync
+	wc.entries[ServiceName].updated = time.Now().Add(-2 * time.Minute)
+	_, ok = wc.get(ServiceName)
+	assert.False(t, ok)
+	wc.entries[ServiceName].updated = time.Now()
+
+	// a new instance of another version may not match the version rule
+	wc.onEvent(&sc.MicroServiceInstanceChangedEvent{
+		Action:   sc.EventCreate,
+		Key:      &scdiscovery.MicroServiceKey{AppId: AppId, ServiceName: ServiceName, Version: "2.0.0"},
+		Instance: &scdiscovery.MicroServiceInstance{InstanceId: "3", Status: sc.MSInstanceUP},
+	})
+	_, ok = wc.get(ServiceName)
+	assert.False(t, ok)
+}
+
+// TestSCResolverWatchResync test the watch cache is always refreshed periodically
+func TestSCResolverWatchResync(t *testing.T) {
+	n := NewSCResolver(SCClient, WithConsumerId("consumer"), WithWatch(0)).(*serviceCombResolver)
+	assert.Equal(t, defaultWatchResync, n.watch.resync)
+	n = NewSCResolver(SCClient, WithConsumerId("consumer"), WithWatch(time.Second)).(*serviceCombResolver)
+	assert.Equal(t, time.Second, n.watch.resync)
+}
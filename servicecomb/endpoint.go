@@ -0,0 +1,52 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package servicecomb
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Endpoint schemes used in the ServiceComb ecosystem.
+const (
+	SchemeKitex   = "kitex"
+	SchemeGRPC    = "grpc"
+	SchemeRest    = "rest"
+	SchemeHighway = "highway"
+)
+
+// FormatEndpoint builds a scheme-prefixed endpoint such as
+// kitex://127.0.0.1:8080?protocol=ttheader. An empty scheme returns hostPort as is.
+func FormatEndpoint(scheme, hostPort string, params url.Values) string {
+	if scheme == "" {
+		return hostPort
+	}
+	u := url.URL{Scheme: scheme, Host: hostPort, RawQuery: params.Encode()}
+	return u.String()
+}
+
+// ParseEndpoint splits an endpoint into its scheme, host:port and query
+// parameters. Bare host:port endpoints have an empty scheme.
+func ParseEndpoint(endpoint string) (scheme, hostPort string, params url.Values, err error) {
+	if !strings.Contains(endpoint, "://") {
+		return "", endpoint, url.Values{}, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("parse endpoint %s error: %w", endpoint, err)
+	}
+	return u.Scheme, u.Host, u.Query(), nil
+}
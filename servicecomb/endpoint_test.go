@@ -0,0 +1,41 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package servicecomb
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestEndpoint test formatting and parsing scheme-prefixed endpoints
+func TestEndpoint(t *testing.T) {
+	params := url.Values{"sslEnabled": []string{"false"}}
+	ep := FormatEndpoint(SchemeKitex, "[::1]:8080", params)
+	assert.Equal(t, "kitex://[::1]:8080?sslEnabled=false", ep)
+
+	scheme, hostPort, got, err := ParseEndpoint(ep)
+	assert.Nil(t, err)
+	assert.Equal(t, SchemeKitex, scheme)
+	assert.Equal(t, "[::1]:8080", hostPort)
+	assert.Equal(t, params, got)
+
+	assert.Equal(t, "127.0.0.1:8080", FormatEndpoint("", "127.0.0.1:8080", nil))
+	scheme, hostPort, _, err = ParseEndpoint("127.0.0.1:8080")
+	assert.Nil(t, err)
+	assert.Equal(t, "", scheme)
+	assert.Equal(t, "127.0.0.1:8080", hostPort)
+}
@@ -26,6 +26,10 @@ const (
 	SC_ENV_PORT            = "serverPort"
 	SC_DEFAULT_SERVER_ADDR = "127.0.0.1"
 	SC_DEFAULT_PORT        = 30100
+
+	SC_ENV_DATACENTER_NAME   = "dataCenterName"
+	SC_ENV_DATACENTER_REGION = "dataCenterRegion"
+	SC_ENV_DATACENTER_ZONE   = "dataCenterAvailableZone"
 )
 
 // SCPort Get ServiceComb port from environment variables
@@ -50,3 +54,8 @@ func SCAddr() string {
 	}
 	return addr
 }
+
+// SCDataCenter Get datacenter name, region and availability zone from environment variables
+func SCDataCenter() (name, region, zone string) {
+	return os.Getenv(SC_ENV_DATACENTER_NAME), os.Getenv(SC_ENV_DATACENTER_REGION), os.Getenv(SC_ENV_DATACENTER_ZONE)
+}
@@ -15,6 +15,7 @@
 package servicecomb
 
 import (
+	"os"
 	"strconv"
 	"testing"
 
@@ -25,3 +26,15 @@ import (
 func TestEnvFunc(t *testing.T) {
 	assert.Equal(t, "127.0.0.1:30100", SCAddr()+":"+strconv.FormatInt(SCPort(), 10))
 }
+
+// TestSCDataCenter test reading datacenter info from env
+func TestSCDataCenter(t *testing.T) {
+	os.Setenv(SC_ENV_DATACENTER_REGION, "cn-north")
+	os.Setenv(SC_ENV_DATACENTER_ZONE, "az1")
+	defer os.Unsetenv(SC_ENV_DATACENTER_REGION)
+	defer os.Unsetenv(SC_ENV_DATACENTER_ZONE)
+	name, region, zone := SCDataCenter()
+	assert.Equal(t, "", name)
+	assert.Equal(t, "cn-north", region)
+	assert.Equal(t, "az1", zone)
+}
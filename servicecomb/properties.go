@@ -0,0 +1,54 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package servicecomb
+
+import "strings"
+
+// ReservedPropertyPrefix is the namespace of instance property keys managed by
+// the registry and resolver themselves. User tags must not use it.
+const ReservedPropertyPrefix = "kitex."
+
+// PropertyWeight is the instance property carrying registry.Info.Weight.
+const PropertyWeight = ReservedPropertyPrefix + "weight"
+
+// Tags of resolved instances describing where they run.
+const (
+	PropertyDataCenter = ReservedPropertyPrefix + "datacenter"
+	PropertyRegion     = ReservedPropertyPrefix + "region"
+	PropertyZone       = ReservedPropertyPrefix + "zone"
+)
+
+// PropertyStale tags resolved instances served from the last known result
+// while ServiceComb is unavailable.
+const PropertyStale = ReservedPropertyPrefix + "stale"
+
+// PropertyStatus tags resolved instances with their ServiceComb status when
+// the resolver is asked to.
+const PropertyStatus = ReservedPropertyPrefix + "status"
+
+// Well-known tags of registry.Info and rpcinfo.EndpointInfo which select the
+// ServiceComb service or instance instead of being instance properties.
+const (
+	TagAppId       = "app_id"
+	TagVersion     = "version"
+	TagVersionRule = "version_rule"
+	TagEnvironment = "environment"
+	TagInstanceId  = "instance_id"
+)
+
+// IsReservedProperty reports whether key belongs to the reserved namespace.
+func IsReservedProperty(key string) bool {
+	return strings.HasPrefix(key, ReservedPropertyPrefix)
+}